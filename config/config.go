@@ -0,0 +1,292 @@
+// Package config loads structs from layered sources: defaults, files,
+// environment variables and command-line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/purposed/good/serialization"
+)
+
+// Source identifies the kind of source a field value came from.
+type Source string
+
+// Configuration sources, from lowest to highest priority.
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Origin describes where a field value came from.
+type Origin struct {
+	Source Source
+
+	// Name is the file path, environment variable or flag name that set the field.
+	Name string
+}
+
+func (o Origin) String() string {
+	if o.Name == "" {
+		return string(o.Source)
+	}
+	return fmt.Sprintf("%s:%s", o.Source, o.Name)
+}
+
+// Report maps field paths (e.g. "Server.Port") to the origin of their value.
+// Fields left untouched by every source are absent.
+type Report map[string]Origin
+
+// MissingFieldsError is returned when required fields are left empty by every source.
+type MissingFieldsError struct {
+	Fields []string
+}
+
+func (e *MissingFieldsError) Error() string {
+	return fmt.Sprintf("missing required fields: %s", strings.Join(e.Fields, ", "))
+}
+
+// Loader loads a struct from several sources, in order:
+//
+//   - defaults, from `default:"..."` struct tags;
+//   - files, decoded with the serialization package in the format matching their extension;
+//   - environment variables, from `env:"NAME"` struct tags;
+//   - command-line flags, from `flag:"name"` struct tags (with an optional `usage:"..."`).
+//
+// Each source overrides the previous ones. Fields tagged `serialization:"required"`
+// must be set once every source has been applied.
+type Loader struct {
+	Files []string
+
+	// IgnoreMissingFiles skips files that do not exist instead of failing.
+	IgnoreMissingFiles bool
+
+	// EnvPrefix is prepended to the names of env tags.
+	EnvPrefix string
+
+	// LookupEnv reads environment variables. Defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+
+	// FlagSet receives the flags defined by flag tags. Defaults to a new flag set.
+	FlagSet *flag.FlagSet
+
+	// Args are the command-line arguments to parse, without the program name.
+	// When nil, flags are not parsed.
+	Args []string
+}
+
+// Load loads outStruct, which must be a pointer to a struct, from every source.
+func (l *Loader) Load(outStruct interface{}) (Report, error) {
+	outValue := reflect.ValueOf(outStruct)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() || outValue.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: outStruct must be a non-nil pointer to a struct, got %T", outStruct)
+	}
+
+	fields := structFields(outValue.Elem().Type(), "", nil)
+	report := make(Report)
+
+	if err := l.loadDefaults(outValue.Elem(), fields, report); err != nil {
+		return report, err
+	}
+	for _, name := range l.Files {
+		if err := l.loadFile(name, outStruct, fields, report); err != nil {
+			return report, err
+		}
+	}
+	if err := l.loadEnv(outValue.Elem(), fields, report); err != nil {
+		return report, err
+	}
+	if err := l.loadFlags(outValue.Elem(), fields, report); err != nil {
+		return report, err
+	}
+
+	return report, checkRequired(outValue.Elem(), fields)
+}
+
+// Load loads outStruct from the given files, the environment and the process arguments.
+func Load(outStruct interface{}, files ...string) (Report, error) {
+	loader := Loader{
+		Files:   files,
+		FlagSet: flag.NewFlagSet(os.Args[0], flag.ContinueOnError),
+		Args:    os.Args[1:],
+	}
+	return loader.Load(outStruct)
+}
+
+func (l *Loader) loadDefaults(v reflect.Value, fields []field, report Report) error {
+	for _, f := range fields {
+		if f.defaultValue == "" {
+			continue
+		}
+		fv, err := f.value(v)
+		if err == nil {
+			err = setString(fv, f.defaultValue)
+		}
+		if err != nil {
+			return fmt.Errorf("config: default of %s: %w", f.path, err)
+		}
+		report[f.path] = Origin{Source: SourceDefault}
+	}
+	return nil
+}
+
+func (l *Loader) loadFile(name string, outStruct interface{}, fields []field, report Report) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) && l.IgnoreMissingFiles {
+			return nil
+		}
+		return err
+	}
+
+	format, err := serialization.DetectFile(name, data)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+
+	origin := Origin{Source: SourceFile, Name: name}
+	doc, err := serialization.DecodeGeneric(bytes.NewReader(data), format)
+	if errors.Is(err, serialization.ErrUnsupportedType) {
+		// The format only decodes into typed values (e.g. XML or gob).
+		return loadTypedFile(name, data, format, outStruct, fields, origin, report)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+	if err := serialization.Decode(bytes.NewReader(data), outStruct, format); err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+
+	markDocument(doc, reflect.TypeOf(outStruct).Elem(), "", origin, report)
+	return nil
+}
+
+// loadTypedFile decodes a file in a format without generic representation.
+// Without a document to tell which keys the file holds, the fields it sets
+// are found by decoding it into an empty struct as well: non-zero fields
+// are reported as coming from the file.
+func loadTypedFile(name string, data []byte, format serialization.Format, outStruct interface{}, fields []field, origin Origin, report Report) error {
+	fresh := reflect.New(reflect.TypeOf(outStruct).Elem())
+	if err := serialization.Decode(bytes.NewReader(data), fresh.Interface(), format); err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+	if err := serialization.Decode(bytes.NewReader(data), outStruct, format); err != nil {
+		return fmt.Errorf("config: %s: %w", name, err)
+	}
+
+	for _, f := range fields {
+		if fv, err := f.value(fresh.Elem()); err == nil && !fv.IsZero() {
+			report[f.path] = origin
+		}
+	}
+	return nil
+}
+
+func (l *Loader) loadEnv(v reflect.Value, fields []field, report Report) error {
+	lookup := l.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		name := l.EnvPrefix + f.env
+		raw, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		fv, err := f.value(v)
+		if err == nil {
+			err = setString(fv, raw)
+		}
+		if err != nil {
+			return fmt.Errorf("config: env %s: %w", name, err)
+		}
+		report[f.path] = Origin{Source: SourceEnv, Name: name}
+	}
+	return nil
+}
+
+func (l *Loader) loadFlags(v reflect.Value, fields []field, report Report) error {
+	if l.Args == nil {
+		return nil
+	}
+
+	flagSet := l.FlagSet
+	if flagSet == nil {
+		flagSet = flag.NewFlagSet("config", flag.ContinueOnError)
+	}
+
+	byName := make(map[string]field)
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+		fv, err := f.value(v)
+		if err != nil {
+			return fmt.Errorf("config: flag %s: %w", f.flag, err)
+		}
+		byName[f.flag] = f
+		flagSet.Var(&flagValue{target: fv}, f.flag, f.usage)
+	}
+
+	if err := flagSet.Parse(l.Args); err != nil {
+		return err
+	}
+
+	flagSet.Visit(func(fl *flag.Flag) {
+		if f, ok := byName[fl.Name]; ok {
+			report[f.path] = Origin{Source: SourceFlag, Name: fl.Name}
+		}
+	})
+	return nil
+}
+
+func checkRequired(v reflect.Value, fields []field) error {
+	var missing []string
+	for _, f := range fields {
+		if !f.required {
+			continue
+		}
+		// Fields behind nil pointers to unexported embedded structs can't be set, so are missing.
+		if fv, err := f.value(v); err != nil || fv.IsZero() {
+			missing = append(missing, f.path)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingFieldsError{Fields: missing}
+	}
+	return nil
+}
+
+// flagValue is a flag.Value writing straight into a struct field.
+type flagValue struct {
+	target reflect.Value
+}
+
+func (f *flagValue) String() string {
+	if !f.target.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(f.target.Interface())
+}
+
+func (f *flagValue) Set(raw string) error {
+	return setString(f.target, raw)
+}
+
+// IsBoolFlag allows boolean flags to be given without a value.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.target.IsValid() && f.target.Kind() == reflect.Bool
+}
@@ -0,0 +1,231 @@
+package config_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/config"
+	"github.com/purposed/good/serialization"
+)
+
+type serverConfig struct {
+	Host string `json:"host" yaml:"host" default:"localhost" env:"HOST"`
+	Port int    `json:"port" yaml:"port" default:"8080" env:"PORT" flag:"port" usage:"listen port"`
+}
+
+type appConfig struct {
+	Name    string        `json:"name" yaml:"name" serialization:"required"`
+	Debug   bool          `json:"debug" yaml:"debug" flag:"debug"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout" default:"5s" env:"TIMEOUT"`
+	Tags    []string      `json:"tags" yaml:"tags" env:"TAGS"`
+	Server  serverConfig  `json:"server" yaml:"server"`
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %s", err.Error())
+	}
+	return path
+}
+
+func Test_Loader_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	base := writeFile(t, dir, "base.yaml", "name: app\nserver:\n  host: example.com\n  port: 9000\n")
+	local := writeFile(t, dir, "local.json", `{"tags": ["a"], "server": {"port": 9100}}`)
+
+	env := map[string]string{"APP_PORT": "9200", "APP_TAGS": "x, y"}
+	loader := config.Loader{
+		Files:              []string{base, local, filepath.Join(dir, "missing.json")},
+		IgnoreMissingFiles: true,
+		EnvPrefix:          "APP_",
+		LookupEnv: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		FlagSet: flag.NewFlagSet("test", flag.ContinueOnError),
+		Args:    []string{"-debug", "-port", "9300"},
+	}
+
+	var cfg appConfig
+	report, err := loader.Load(&cfg)
+	if err != nil {
+		t.Errorf("Load() error = %s", err.Error())
+		return
+	}
+
+	expected := appConfig{
+		Name:    "app",
+		Debug:   true,
+		Timeout: 5 * time.Second,
+		Tags:    []string{"x", "y"},
+		Server:  serverConfig{Host: "example.com", Port: 9300},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Load() = %+v, want %+v", cfg, expected)
+	}
+
+	expectedReport := config.Report{
+		"Name":        {Source: config.SourceFile, Name: base},
+		"Debug":       {Source: config.SourceFlag, Name: "debug"},
+		"Timeout":     {Source: config.SourceDefault},
+		"Tags":        {Source: config.SourceEnv, Name: "APP_TAGS"},
+		"Server.Host": {Source: config.SourceFile, Name: base},
+		"Server.Port": {Source: config.SourceFlag, Name: "port"},
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("Load() report = %v, want %v", report, expectedReport)
+	}
+}
+
+func Test_Loader_Required(t *testing.T) {
+	loader := config.Loader{LookupEnv: func(string) (string, bool) { return "", false }}
+
+	var cfg appConfig
+	_, err := loader.Load(&cfg)
+	if err == nil {
+		t.Errorf("Load() expected error")
+		return
+	}
+
+	missing, ok := err.(*config.MissingFieldsError)
+	if !ok {
+		t.Errorf("Load() error = %s, want *MissingFieldsError", err.Error())
+		return
+	}
+	if !reflect.DeepEqual(missing.Fields, []string{"Name"}) {
+		t.Errorf("MissingFieldsError.Fields = %v", missing.Fields)
+	}
+}
+
+func Test_Loader_InvalidEnv(t *testing.T) {
+	loader := config.Loader{LookupEnv: func(name string) (string, bool) {
+		return "not-a-number", name == "PORT"
+	}}
+
+	var cfg appConfig
+	if _, err := loader.Load(&cfg); err == nil {
+		t.Errorf("Load() expected error")
+	}
+}
+
+func Test_Loader_FileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	loader := config.Loader{Files: []string{writeFile(t, dir, "app.json", `{"name": }`)}}
+
+	var cfg appConfig
+	_, err = loader.Load(&cfg)
+	var decodeErr *serialization.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Load() error = %v, want a DecodeError", err)
+	}
+}
+
+func Test_Loader_TypedOnlyFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.xml", "<config><Name>app</Name><Server><Port>9000</Port></Server></config>")
+	loader := config.Loader{Files: []string{path}}
+
+	var cfg appConfig
+	report, err := loader.Load(&cfg)
+	if err != nil {
+		t.Errorf("Load() error = %s", err.Error())
+		return
+	}
+
+	if cfg.Name != "app" || cfg.Server.Host != "localhost" || cfg.Server.Port != 9000 {
+		t.Errorf("Load() = %+v", cfg)
+	}
+
+	file := config.Origin{Source: config.SourceFile, Name: path}
+	expectedReport := config.Report{
+		"Name":        file,
+		"Timeout":     {Source: config.SourceDefault},
+		"Server.Host": {Source: config.SourceDefault},
+		"Server.Port": file,
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("Load() report = %v, want %v", report, expectedReport)
+	}
+}
+
+type taggedConfig struct {
+	ListenAddr string `toml:"listen_addr"`
+	MaxConns   int    `cbor:"max_conns" toml:"max_conns"`
+	Other      string
+}
+
+func Test_Loader_ReportTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.toml", "listen_addr = \":80\"\nmax_conns = 10\n\"\" = \"x\"\n")
+	loader := config.Loader{Files: []string{path}}
+
+	var cfg taggedConfig
+	report, err := loader.Load(&cfg)
+	if err != nil {
+		t.Errorf("Load() error = %s", err.Error())
+		return
+	}
+
+	file := config.Origin{Source: config.SourceFile, Name: path}
+	expectedReport := config.Report{"ListenAddr": file, "MaxConns": file}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("Load() report = %v, want %v", report, expectedReport)
+	}
+}
+
+type hiddenConfig struct {
+	Level string `json:"level" env:"LEVEL"`
+}
+
+type embeddingConfig struct {
+	*hiddenConfig
+	Name string `json:"name"`
+}
+
+func Test_Loader_UnexportedEmbeddedPointer(t *testing.T) {
+	loader := config.Loader{LookupEnv: func(name string) (string, bool) {
+		return "debug", name == "LEVEL"
+	}}
+
+	var cfg embeddingConfig
+	if _, err := loader.Load(&cfg); err == nil {
+		t.Errorf("Load() expected error")
+	}
+
+	// Nothing is set through the pointer without a value to set.
+	loader.LookupEnv = func(string) (string, bool) { return "", false }
+	if _, err := loader.Load(&cfg); err != nil {
+		t.Errorf("Load() error = %s", err.Error())
+	}
+}
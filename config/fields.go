@@ -0,0 +1,238 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/purposed/good/internal/structs"
+	"github.com/purposed/good/serialization"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// field is a leaf field of a configuration struct.
+type field struct {
+	path  string
+	index []int
+
+	defaultValue string
+	env          string
+	flag         string
+	usage        string
+	required     bool
+}
+
+// value returns the field in v, allocating nil struct pointers on the way.
+// It fails on nil pointers to unexported embedded structs, which cannot be set.
+func (f field) value(v reflect.Value) (reflect.Value, error) {
+	for _, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct: %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, nil
+}
+
+// isNested returns whether values of t are configured field by field.
+func isNested(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func structFields(t reflect.Type, prefix string, index []int) []field {
+	var fields []field
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		path := prefix + sf.Name
+		if sf.Anonymous {
+			path = strings.TrimSuffix(prefix, ".")
+		}
+
+		if isNested(sf.Type) {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			nestedPrefix := path + "."
+			if path == "" {
+				nestedPrefix = ""
+			}
+			fields = append(fields, structFields(ft, nestedPrefix, fieldIndex)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		fields = append(fields, field{
+			path:         path,
+			index:        fieldIndex,
+			defaultValue: sf.Tag.Get("default"),
+			env:          sf.Tag.Get("env"),
+			flag:         sf.Tag.Get("flag"),
+			usage:        sf.Tag.Get("usage"),
+			required:     structs.IsRequired(sf),
+		})
+	}
+	return fields
+}
+
+// matchField finds the struct field a document key refers to, by the tag of
+// any registered format or, failing that, by a case-insensitive match of its name.
+func matchField(t reflect.Type, key string) (reflect.StructField, bool) {
+	tagNames := serialization.FieldTags()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		for _, tagName := range tagNames {
+			name := strings.Split(sf.Tag.Get(tagName), ",")[0]
+			if name != "" && name != "-" && name == key {
+				return sf, true
+			}
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); strings.EqualFold(sf.Name, key) {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// markDocument records origin for every field of t present in a generic document.
+func markDocument(doc interface{}, t reflect.Type, prefix string, origin Origin, report Report) {
+	items, ok := doc.(serialization.OrderedMap)
+	if !ok {
+		return
+	}
+
+	for _, item := range items {
+		key, ok := item.Key.(string)
+		if !ok {
+			continue
+		}
+		sf, ok := matchField(t, key)
+		if !ok {
+			markEmbedded(item, t, prefix, origin, report)
+			continue
+		}
+
+		if isNested(sf.Type) {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			markDocument(item.Value, ft, prefix+sf.Name+".", origin, report)
+			continue
+		}
+		report[prefix+sf.Name] = origin
+	}
+}
+
+// markEmbedded looks for the field of a document item among the embedded structs of t.
+func markEmbedded(item serialization.MapItem, t reflect.Type, prefix string, origin Origin, report Report) {
+	for i := 0; i < t.NumField(); i++ {
+		if sf := t.Field(i); sf.Anonymous && isNested(sf.Type) {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			markDocument(serialization.OrderedMap{item}, ft, prefix, origin, report)
+		}
+	}
+}
+
+// setString parses raw into v according to its type. Slices are comma separated.
+func setString(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return fmt.Errorf("cannot set %s", v.Type())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setString(v.Elem(), raw)
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		if raw != "" {
+			parts = strings.Split(raw, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
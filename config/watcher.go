@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/purposed/good"
+)
+
+// DefaultPollInterval is the interval at which watched files are checked for changes.
+const DefaultPollInterval = time.Second
+
+// Validator is implemented by configuration structs checking their own consistency.
+type Validator interface {
+	Validate() error
+}
+
+// Subscriber is notified with the previous and the new configuration after each reload.
+type Subscriber func(old, new interface{})
+
+// WatchParameters are used to configure a watcher.
+type WatchParameters struct {
+	// Loader loads the configuration. Its files are watched for changes.
+	// Flags are not parsed by the watcher.
+	Loader Loader
+
+	// New returns a pointer to a fresh configuration struct.
+	New func() interface{}
+
+	// Validate optionally rejects a configuration, in addition to Validator.
+	Validate func(interface{}) error
+
+	// Interval is the polling interval, DefaultPollInterval when zero.
+	Interval time.Duration
+
+	// Signals trigger a reload, syscall.SIGHUP when nil.
+	Signals []os.Signal
+
+	Logger good.Logger
+}
+
+// Watcher holds a configuration, reloading it when its files change
+// or when the process receives a signal.
+type Watcher struct {
+	loader   Loader
+	newFn    func() interface{}
+	validate func(interface{}) error
+	interval time.Duration
+	signals  []os.Signal
+
+	log good.Logger
+
+	current atomic.Value
+	report  atomic.Value
+
+	subscribersLock sync.RWMutex
+	subscribers     []Subscriber
+
+	reloadLock sync.Mutex
+	stamps     map[string]fileStamp
+
+	// pending holds the notifications of the reloads, in the order of the swaps.
+	notifyLock sync.Mutex
+	pending    []notification
+	notifying  bool
+
+	stop     chan bool
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type notification struct {
+	old, new interface{}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher returns a watcher holding the initial configuration.
+// It fails when the initial configuration cannot be loaded.
+func NewWatcher(p WatchParameters) (*Watcher, error) {
+	if p.New == nil {
+		return nil, fmt.Errorf("config: watcher requires a New function")
+	}
+
+	logger := p.Logger
+	if p.Logger == nil {
+		logger = good.DefaultLogger
+	}
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	signals := p.Signals
+	if signals == nil {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	loader := p.Loader
+	loader.Args = nil
+
+	w := &Watcher{
+		loader:   loader,
+		newFn:    p.New,
+		validate: p.Validate,
+		interval: interval,
+		signals:  signals,
+		log:      logger,
+		stop:     make(chan bool),
+	}
+
+	w.stamps = w.stat()
+	cfg, report, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(cfg)
+	w.report.Store(report)
+	return w, nil
+}
+
+// Current returns the current configuration. It must not be modified.
+func (w *Watcher) Current() interface{} {
+	return w.current.Load()
+}
+
+// Report returns the origin of the fields of the current configuration.
+func (w *Watcher) Report() Report {
+	return w.report.Load().(Report)
+}
+
+// Subscribe registers a function called after each successful reload.
+// Subscribers are called once the reload completed, so they may call Reload.
+// They are called from one goroutine at a time, in the order of the reloads.
+func (w *Watcher) Subscribe(fn Subscriber) {
+	w.subscribersLock.Lock()
+	defer w.subscribersLock.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads, validates and swaps in the configuration, notifying subscribers.
+// An invalid configuration is rejected and the current one is kept.
+func (w *Watcher) Reload() error {
+	w.reloadLock.Lock()
+	w.stamps = w.stat()
+	err := w.reload()
+	w.reloadLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+	w.notify()
+	return nil
+}
+
+// reload loads and swaps in the configuration, queueing the notification of the subscribers.
+// It must be called with reloadLock held.
+func (w *Watcher) reload() error {
+	cfg, report, err := w.load()
+	if err != nil {
+		w.log.Errorf("rejected configuration reload: %s", err.Error())
+		return err
+	}
+
+	old := w.current.Load()
+	w.current.Store(cfg)
+	w.report.Store(report)
+	w.log.Info("configuration reloaded")
+
+	w.notifyLock.Lock()
+	w.pending = append(w.pending, notification{old: old, new: cfg})
+	w.notifyLock.Unlock()
+	return nil
+}
+
+// notify calls the subscribers with the pending notifications. It must be
+// called without reloadLock held. When another call is already notifying,
+// including a Reload from a subscriber, that call delivers the notifications
+// queued in the meantime, so subscribers see the reloads in order.
+func (w *Watcher) notify() {
+	w.notifyLock.Lock()
+	if w.notifying {
+		w.notifyLock.Unlock()
+		return
+	}
+	w.notifying = true
+
+	for len(w.pending) > 0 {
+		n := w.pending[0]
+		w.pending = w.pending[1:]
+		w.notifyLock.Unlock()
+
+		w.subscribersLock.RLock()
+		subscribers := make([]Subscriber, len(w.subscribers))
+		copy(subscribers, w.subscribers)
+		w.subscribersLock.RUnlock()
+
+		for _, fn := range subscribers {
+			fn(n.old, n.new)
+		}
+		w.notifyLock.Lock()
+	}
+
+	w.notifying = false
+	w.notifyLock.Unlock()
+}
+
+func (w *Watcher) load() (interface{}, Report, error) {
+	cfg := w.newFn()
+	if reflect.ValueOf(cfg).Kind() != reflect.Ptr {
+		return nil, nil, fmt.Errorf("config: New must return a pointer, got %T", cfg)
+	}
+
+	report, err := w.loader.Load(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if validator, ok := cfg.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if w.validate != nil {
+		if err := w.validate(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	return cfg, report, nil
+}
+
+// stat returns the modification stamps of the watched files.
+func (w *Watcher) stat() map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(w.loader.Files))
+	for _, name := range w.loader.Files {
+		if info, err := os.Stat(name); err == nil {
+			stamps[name] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// checkFiles reloads the configuration if a watched file changed since the last check.
+func (w *Watcher) checkFiles() {
+	w.reloadLock.Lock()
+	stamps := w.stat()
+	if reflect.DeepEqual(stamps, w.stamps) {
+		w.reloadLock.Unlock()
+		return
+	}
+	w.stamps = stamps
+
+	w.log.Info("configuration file changed")
+	err := w.reload()
+	w.reloadLock.Unlock()
+
+	if err == nil {
+		w.notify()
+	}
+}
+
+// Start starts watching in the background.
+func (w *Watcher) Start() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, w.signals...)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer signal.Stop(sigs)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.checkFiles()
+			case sig := <-sigs:
+				w.log.Infof("received %s, reloading configuration", sig)
+				w.Reload()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops watching. It may be called several times, and without Start.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	w.wg.Wait()
+}
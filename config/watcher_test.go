@@ -0,0 +1,222 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/config"
+)
+
+type watchedConfig struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+func (c *watchedConfig) Validate() error {
+	if c.Limit < 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+func newWatcher(t *testing.T, path string, signals ...os.Signal) *config.Watcher {
+	watcher, err := config.NewWatcher(config.WatchParameters{
+		Loader:   config.Loader{Files: []string{path}},
+		New:      func() interface{} { return &watchedConfig{} },
+		Interval: 10 * time.Millisecond,
+		Signals:  signals,
+	})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %s", err.Error())
+	}
+	return watcher
+}
+
+func waitFor(updates chan [2]*watchedConfig) ([2]*watchedConfig, bool) {
+	select {
+	case update := <-updates:
+		return update, true
+	case <-time.After(2 * time.Second):
+		return [2]*watchedConfig{}, false
+	}
+}
+
+func Test_Watcher_FileChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"name": "first", "limit": 1}`)
+	watcher := newWatcher(t, path)
+
+	updates := make(chan [2]*watchedConfig, 1)
+	watcher.Subscribe(func(old, new interface{}) {
+		updates <- [2]*watchedConfig{old.(*watchedConfig), new.(*watchedConfig)}
+	})
+
+	watcher.Start()
+	defer watcher.Stop()
+
+	// Invalid reloads are rejected and the current configuration is kept.
+	writeFile(t, dir, "app.json", `{"name": "invalid", "limit": -1}`)
+	time.Sleep(100 * time.Millisecond)
+	if current := watcher.Current().(*watchedConfig); current.Name != "first" {
+		t.Errorf("Current().Name = %s, want first", current.Name)
+	}
+
+	writeFile(t, dir, "app.json", `{"name": "second", "limit": 2}`)
+	update, ok := waitFor(updates)
+	if !ok {
+		t.Errorf("no reload notification")
+		return
+	}
+	if update[0].Name != "first" || update[1].Name != "second" {
+		t.Errorf("notified with %v -> %v", update[0], update[1])
+	}
+	if current := watcher.Current().(*watchedConfig); current != update[1] {
+		t.Errorf("Current() = %v, want %v", current, update[1])
+	}
+}
+
+func Test_NewWatcher_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"limit": -1}`)
+	_, err = config.NewWatcher(config.WatchParameters{
+		Loader: config.Loader{Files: []string{path}},
+		New:    func() interface{} { return &watchedConfig{} },
+	})
+	if err == nil {
+		t.Errorf("NewWatcher() expected error")
+	}
+}
+
+func Test_Watcher_Stop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"name": "first"}`)
+
+	done := make(chan bool)
+	go func() {
+		// Stopping twice, or without starting, returns.
+		newWatcher(t, path).Stop()
+
+		watcher := newWatcher(t, path)
+		watcher.Start()
+		watcher.Stop()
+		watcher.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Stop() blocked")
+	}
+}
+
+func Test_Watcher_SubscriberReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"name": "first"}`)
+	watcher := newWatcher(t, path)
+
+	calls := 0
+	watcher.Subscribe(func(old, new interface{}) {
+		calls++
+		if calls == 1 {
+			// A subscriber may trigger a reload of its own.
+			watcher.Reload()
+		}
+	})
+
+	done := make(chan error)
+	go func() { done <- watcher.Reload() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Reload() error = %s", err.Error())
+		}
+		if calls != 2 {
+			t.Errorf("subscriber called %d times, want 2", calls)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Reload() from a subscriber deadlocked")
+	}
+}
+
+func Test_Watcher_ConcurrentReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"name": "first"}`)
+	watcher := newWatcher(t, path)
+
+	var (
+		lock       sync.Mutex
+		last       = watcher.Current()
+		outOfOrder int
+	)
+	watcher.Subscribe(func(old, new interface{}) {
+		// Widen the window in which concurrent notifications could overtake each other.
+		time.Sleep(time.Millisecond)
+
+		lock.Lock()
+		defer lock.Unlock()
+		if old != last {
+			outOfOrder++
+		}
+		last = new
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := watcher.Reload(); err != nil {
+					t.Errorf("Reload() error = %s", err.Error())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if outOfOrder != 0 {
+		t.Errorf("%d notifications delivered out of order", outOfOrder)
+	}
+	if last != watcher.Current() {
+		t.Errorf("last notified configuration differs from Current()")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func Test_Watcher_Signal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Errorf("TempDir() error = %s", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "app.json", `{"name": "first"}`)
+	watcher := newWatcher(t, path, syscall.SIGUSR1)
+
+	updates := make(chan [2]*watchedConfig, 1)
+	watcher.Subscribe(func(old, new interface{}) {
+		updates <- [2]*watchedConfig{old.(*watchedConfig), new.(*watchedConfig)}
+	})
+
+	watcher.Start()
+	defer watcher.Stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Errorf("Kill() error = %s", err.Error())
+		return
+	}
+	if _, ok := waitFor(updates); !ok {
+		t.Errorf("no reload notification")
+	}
+}
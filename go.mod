@@ -1,5 +1,12 @@
 module github.com/purposed/good
 
-go 1.12
+go 1.13
 
-require github.com/tinylib/msgp v1.1.6
+require (
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/golang/snappy v0.0.4
+	github.com/pelletier/go-toml v1.9.5
+	github.com/tinylib/msgp v1.1.6
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,133 @@
+// Package structs lists the serialized fields of struct types, as shared by
+// the serializers, the schema generator and the configuration loader.
+package structs
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Field describes a serialized struct field.
+type Field struct {
+	Name      string
+	Index     []int
+	Type      reflect.Type
+	OmitEmpty bool
+	Required  bool
+}
+
+// Tag holds the name and options of a field tag.
+type Tag struct {
+	Name      string
+	OmitEmpty bool
+	Inline    bool
+	Tagged    bool
+}
+
+// ParseTag returns the name and options of the first tag present among tagNames.
+func ParseTag(field reflect.StructField, tagNames []string) Tag {
+	for _, tagName := range tagNames {
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		parsed := Tag{Name: parts[0], Tagged: true}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "omitempty":
+				parsed.OmitEmpty = true
+			case "inline":
+				parsed.Inline = true
+			}
+		}
+		return parsed
+	}
+	return Tag{}
+}
+
+// IsRequired returns whether the field is tagged with `serialization:"required"`.
+func IsRequired(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("serialization"), ",") {
+		if opt == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields returns the serialized fields of a struct type, honouring the first
+// tag found among tagNames. Untagged embedded structs and fields tagged inline
+// are flattened, a shallower field taking precedence over a deeper one of the
+// same name.
+func Fields(t reflect.Type, tagNames []string) []Field {
+	var fields []Field
+	seen := make(map[string]bool)
+
+	type level struct {
+		typ   reflect.Type
+		index []int
+	}
+	current := []level{{typ: t}}
+	visited := map[reflect.Type]bool{}
+
+	for len(current) > 0 {
+		var next []level
+
+		for _, lvl := range current {
+			if visited[lvl.typ] {
+				continue
+			}
+			visited[lvl.typ] = true
+
+			for i := 0; i < lvl.typ.NumField(); i++ {
+				sf := lvl.typ.Field(i)
+
+				tag := ParseTag(sf, tagNames)
+				if tag.Name == "-" {
+					continue
+				}
+
+				index := make([]int, len(lvl.index)+1)
+				copy(index, lvl.index)
+				index[len(lvl.index)] = i
+
+				ft := sf.Type
+				if (sf.Anonymous && !tag.Tagged) || tag.Inline {
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, level{typ: ft, index: index})
+						continue
+					}
+				}
+
+				if sf.PkgPath != "" {
+					// Unexported field.
+					continue
+				}
+
+				name := tag.Name
+				if name == "" {
+					name = sf.Name
+				}
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+
+				fields = append(fields, Field{
+					Name:      name,
+					Index:     index,
+					Type:      sf.Type,
+					OmitEmpty: tag.OmitEmpty,
+					Required:  IsRequired(sf),
+				})
+			}
+		}
+		current = next
+	}
+	return fields
+}
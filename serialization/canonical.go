@@ -0,0 +1,407 @@
+package serialization
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Canonical formats, producing identical bytes for identical values.
+const (
+	CanonicalJSON    Format = "application/x-canonical-json"
+	CanonicalMsgPack Format = "application/x-canonical-msgpack"
+)
+
+// canonicalFormats maps formats to their canonical variant.
+var canonicalFormats = map[Format]Format{
+	JSON:             CanonicalJSON,
+	CanonicalJSON:    CanonicalJSON,
+	MsgPack:          CanonicalMsgPack,
+	CanonicalMsgPack: CanonicalMsgPack,
+}
+
+// Digest returns the SHA-256 of the canonical encoding of inStruct in format,
+// which must be JSON, MsgPack or one of their canonical variants.
+func Digest(inStruct interface{}, format Format) ([sha256.Size]byte, error) {
+	canonical, ok := Resolve(format)
+	if ok {
+		canonical, ok = canonicalFormats[canonical]
+	}
+	if !ok {
+		return [sha256.Size]byte{}, fmt.Errorf("no canonical encoding for format: %s", format)
+	}
+
+	data, err := Marshal(inStruct, canonical)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// CanonicalJSONSerializer serializes messages to canonical json as defined by
+// RFC 8785: object keys sorted by UTF-16 code units, no insignificant
+// whitespace, minimal string escaping and ECMAScript number formatting.
+// As in RFC 8785, numbers are IEEE 754 doubles: integers beyond 2^53 lose precision.
+type CanonicalJSONSerializer struct {
+	JSONSerializer
+}
+
+// Marshal marshals inStruct to canonical json.
+func (m *CanonicalJSONSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	data, err := m.JSONSerializer.MarshalWithOptions(inStruct, EncodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := m.JSONSerializer.DecodeGeneric(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalAppend appends the canonical json encoding of inStruct to dst.
+func (m *CanonicalJSONSerializer) MarshalAppend(dst []byte, inStruct interface{}) ([]byte, error) {
+	data, err := m.Marshal(inStruct)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
+
+// Sniff never claims a payload, canonical json is detected as JSON.
+func (m *CanonicalJSONSerializer) Sniff(data []byte) int {
+	return 0
+}
+
+// Encode marshals the struct to a stream in canonical json.
+func (m *CanonicalJSONSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	data, err := m.Marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// MarshalWithOptions marshals inStruct to canonical json. The canonical
+// encoding has no options, opts is ignored.
+func (m *CanonicalJSONSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	return m.Marshal(inStruct)
+}
+
+// EncodeWithOptions marshals the struct to a stream in canonical json, ignoring opts.
+func (m *CanonicalJSONSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	return m.Encode(inStruct, w)
+}
+
+// EncodeGeneric encodes a generic value as canonical json.
+func (m *CanonicalJSONSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// NewRecordEncoder returns an encoder writing newline-delimited canonical json.
+func (m *CanonicalJSONSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	return &canonicalRecordEncoder{w: w, marshal: m.Marshal, separator: '\n'}
+}
+
+func writeCanonicalJSON(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+	case int64:
+		return writeCanonicalNumber(buf, float64(x))
+	case uint64:
+		return writeCanonicalNumber(buf, float64(x))
+	case float64:
+		return writeCanonicalNumber(buf, x)
+	case string:
+		writeCanonicalString(buf, x)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case OrderedMap:
+		items := make([]MapItem, len(x))
+		copy(items, x)
+		keys := make([][]uint16, len(items))
+		for i, item := range items {
+			keys[i] = utf16.Encode([]rune(item.Key.(string)))
+		}
+		sort.Sort(&utf16Sorter{items: items, keys: keys})
+
+		buf.WriteByte('{')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, item.Key.(string))
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("json: unsupported canonical value %T", v)
+	}
+	return nil
+}
+
+// utf16Sorter sorts map items by the UTF-16 code units of their keys.
+type utf16Sorter struct {
+	items []MapItem
+	keys  [][]uint16
+}
+
+func (s *utf16Sorter) Len() int { return len(s.items) }
+
+func (s *utf16Sorter) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s *utf16Sorter) Less(i, j int) bool {
+	a, b := s.keys[i], s.keys[j]
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// writeCanonicalNumber formats a number as ECMAScript's Number.prototype.toString does.
+func writeCanonicalNumber(buf *bytes.Buffer, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("json: unsupported float value %v", f)
+	}
+	if f == 0 {
+		buf.WriteByte('0')
+		return nil
+	}
+
+	abs := math.Abs(f)
+	if abs < 1e21 && abs >= 1e-6 {
+		buf.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+		return nil
+	}
+
+	// Go pads exponents to two digits ("1e-07"), ECMAScript does not ("1e-7").
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	idx := strings.IndexByte(s, 'e')
+	mantissa, sign, exponent := s[:idx], s[idx+1], strings.TrimLeft(s[idx+2:], "0")
+	buf.WriteString(mantissa)
+	buf.WriteByte('e')
+	buf.WriteByte(sign)
+	buf.WriteString(exponent)
+	return nil
+}
+
+// writeCanonicalString writes a string escaping only what RFC 8785 requires.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			buf.WriteRune(r)
+			i += size
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+		i++
+	}
+	buf.WriteByte('"')
+}
+
+// CanonicalMsgpackSerializer serializes messages to canonical msgpack: map
+// entries sorted by the bytes of their encoded keys, non-negative integers
+// encoded as unsigned and every integer in its smallest encoding.
+type CanonicalMsgpackSerializer struct {
+	MsgpackSerializer
+}
+
+// Marshal marshals inStruct to canonical msgpack.
+func (m *CanonicalMsgpackSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	data, err := m.MsgpackSerializer.MarshalWithOptions(inStruct, EncodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	doc, _, err := readMsgpackGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return appendCanonicalMsgpack(nil, doc)
+}
+
+// MarshalAppend appends the canonical msgpack encoding of inStruct to dst.
+func (m *CanonicalMsgpackSerializer) MarshalAppend(dst []byte, inStruct interface{}) ([]byte, error) {
+	data, err := m.MsgpackSerializer.MarshalWithOptions(inStruct, EncodeOptions{})
+	if err != nil {
+		return dst, err
+	}
+
+	doc, _, err := readMsgpackGeneric(data)
+	if err != nil {
+		return dst, err
+	}
+	return appendCanonicalMsgpack(dst, doc)
+}
+
+// Sniff never claims a payload, canonical msgpack is detected as MsgPack.
+func (m *CanonicalMsgpackSerializer) Sniff(data []byte) int {
+	return 0
+}
+
+// Encode marshals the struct to a stream in canonical msgpack.
+func (m *CanonicalMsgpackSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	data, err := m.Marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// MarshalWithOptions marshals inStruct to canonical msgpack. The canonical
+// encoding has no options, opts is ignored.
+func (m *CanonicalMsgpackSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	return m.Marshal(inStruct)
+}
+
+// EncodeWithOptions marshals the struct to a stream in canonical msgpack, ignoring opts.
+func (m *CanonicalMsgpackSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	return m.Encode(inStruct, w)
+}
+
+// EncodeGeneric encodes a generic value as canonical msgpack.
+func (m *CanonicalMsgpackSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	data, err := appendCanonicalMsgpack(nil, v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// NewRecordEncoder returns an encoder writing concatenated canonical msgpack objects.
+func (m *CanonicalMsgpackSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	return &canonicalRecordEncoder{w: w, marshal: m.Marshal}
+}
+
+// canonicalRecordEncoder writes records in their canonical encoding,
+// each followed by the separator when set.
+type canonicalRecordEncoder struct {
+	w         io.Writer
+	marshal   func(inStruct interface{}) ([]byte, error)
+	separator byte
+}
+
+func (e *canonicalRecordEncoder) Encode(inStruct interface{}) error {
+	data, err := e.marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	if e.separator != 0 {
+		data = append(data, e.separator)
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func appendCanonicalMsgpack(b []byte, v interface{}) ([]byte, error) {
+	var err error
+
+	switch x := v.(type) {
+	case int64:
+		if x >= 0 {
+			return msgp.AppendUint64(b, uint64(x)), nil
+		}
+		return msgp.AppendInt64(b, x), nil
+	case []interface{}:
+		b = msgp.AppendArrayHeader(b, uint32(len(x)))
+		for _, item := range x {
+			if b, err = appendCanonicalMsgpack(b, item); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case OrderedMap:
+		type entry struct {
+			key, value []byte
+		}
+		entries := make([]entry, len(x))
+		for i, item := range x {
+			if entries[i].key, err = appendCanonicalMsgpack(nil, item.Key); err != nil {
+				return b, err
+			}
+			if entries[i].value, err = appendCanonicalMsgpack(nil, item.Value); err != nil {
+				return b, err
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+
+		b = msgp.AppendMapHeader(b, uint32(len(entries)))
+		for _, e := range entries {
+			b = append(b, e.key...)
+			b = append(b, e.value...)
+		}
+		return b, nil
+	}
+	return appendMsgpackGeneric(b, v)
+}
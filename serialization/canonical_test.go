@@ -0,0 +1,138 @@
+package serialization_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+func Test_CanonicalJSON(t *testing.T) {
+	type test struct {
+		name  string
+		input interface{}
+		want  string
+	}
+
+	tests := []test{
+		{"SortedKeys", map[string]interface{}{"b": 1, "a": 2, "\uFB33": 3, "\U0001F600": 4}, "{\"a\":2,\"b\":1,\"\U0001F600\":4,\"\uFB33\":3}"},
+		{"NestedStruct", struct {
+			Z []int           `json:"z"`
+			A map[string]bool `json:"a"`
+		}{Z: []int{3, 1}, A: map[string]bool{"y": true, "x": false}}, `{"a":{"x":false,"y":true},"z":[3,1]}`},
+		{"Numbers", []interface{}{0, -0.0, 1.5, 1e21, 1e-7, 123456789, 0.000001, 1e300}, `[0,0,1.5,1e+21,1e-7,123456789,0.000001,1e+300]`},
+		{"Strings", "<a>é\"\\\n\u0001", `"<a>é\"\\\n\u0001"`},
+	}
+
+	for _, tCase := range tests {
+		t.Run(tCase.name, func(t *testing.T) {
+			data, err := serialization.Marshal(tCase.input, serialization.CanonicalJSON)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+			if string(data) != tCase.want {
+				t.Errorf("Marshal() = %s, want %s", data, tCase.want)
+			}
+		})
+	}
+}
+
+func Test_CanonicalMsgpack(t *testing.T) {
+	first, err := serialization.Marshal(map[string]interface{}{"bb": 200, "a": -1, "c": []int{1}}, serialization.CanonicalMsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	// Keys sorted by encoded bytes, 200 as uint8.
+	want := []byte{0x83, 0xa1, 'a', 0xff, 0xa1, 'c', 0x91, 0x01, 0xa2, 'b', 'b', 0xcc, 0xc8}
+	if !bytes.Equal(first, want) {
+		t.Errorf("Marshal() = %x, want %x", first, want)
+	}
+
+	var out map[string]interface{}
+	if err := serialization.Unmarshal(first, &out, serialization.CanonicalMsgPack); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	if len(out) != 3 {
+		t.Errorf("Unmarshal() = %v", out)
+	}
+}
+
+func Test_Digest(t *testing.T) {
+	type doc struct {
+		Name string            `json:"name" msg:"name"`
+		Tags map[string]string `json:"tags" msg:"tags"`
+	}
+
+	a := doc{Name: "x", Tags: map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"}}
+	b := map[string]interface{}{"tags": map[string]interface{}{"k3": "v3", "k2": "v2", "k1": "v1"}, "name": "x"}
+
+	for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack} {
+		da, err := serialization.Digest(a, format)
+		if err != nil {
+			t.Errorf("Digest() error = %s", err.Error())
+			return
+		}
+		db, err := serialization.Digest(b, format)
+		if err != nil {
+			t.Errorf("Digest() error = %s", err.Error())
+			return
+		}
+		if da != db {
+			t.Errorf("Digest(%s) differs between equivalent values", format)
+		}
+	}
+
+	if _, err := serialization.Digest(a, serialization.YAML); err == nil {
+		t.Errorf("Digest() expected error for yaml")
+	}
+}
+
+func Test_CanonicalInheritedMethods(t *testing.T) {
+	in := map[string]interface{}{"b": 1, "a": []int{2}}
+	doc := serialization.OrderedMap{{Key: "b", Value: int64(1)}, {Key: "a", Value: []interface{}{int64(2)}}}
+
+	for _, format := range []serialization.Format{serialization.CanonicalJSON, serialization.CanonicalMsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			want, err := serialization.Marshal(in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			s, _ := serialization.Lookup(format)
+			configurable := s.(serialization.ConfigurableEncoder)
+			got, err := configurable.MarshalWithOptions(in, serialization.EncodeOptions{Indent: "  "})
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("MarshalWithOptions() = %q, %v, want %q", got, err, want)
+			}
+
+			var buf bytes.Buffer
+			if err := configurable.EncodeWithOptions(in, &buf, serialization.EncodeOptions{Indent: "  "}); err != nil || !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("EncodeWithOptions() = %q, %v, want %q", buf.Bytes(), err, want)
+			}
+
+			buf.Reset()
+			if err := serialization.EncodeGeneric(doc, &buf, format); err != nil || !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("EncodeGeneric() = %q, %v, want %q", buf.Bytes(), err, want)
+			}
+
+			buf.Reset()
+			enc, err := serialization.NewStreamEncoder(&buf, format)
+			if err != nil {
+				t.Errorf("NewStreamEncoder() error = %s", err.Error())
+				return
+			}
+			if err := enc.Encode(in); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+			if !bytes.HasPrefix(buf.Bytes(), want) {
+				t.Errorf("stream record = %q, want %q", buf.Bytes(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package serialization
+
+import (
+	"io"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORSerializer serializes messages to cbor (RFC 8949).
+// Struct fields are named by their cbor tag, falling back to their json tag.
+type CBORSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
+}
+
+// cborEncModes caches the encoding modes, building one is costly.
+// They are keyed by the bits of the options they honour.
+var cborEncModes sync.Map
+
+// cborEncMode returns the cbor encoding mode matching opts. Times are encoded
+// as RFC 3339 strings with nanoseconds, so they round-trip as in json.
+func cborEncMode(opts EncodeOptions) (cbor.EncMode, error) {
+	key := 0
+	if opts.SortMapKeys {
+		key |= 1
+	}
+	if opts.CompactFloats {
+		key |= 2
+	}
+	if mode, ok := cborEncModes.Load(key); ok {
+		return mode.(cbor.EncMode), nil
+	}
+
+	encOpts := cbor.EncOptions{
+		Time:    cbor.TimeRFC3339Nano,
+		TimeTag: cbor.EncTagRequired,
+	}
+	if opts.SortMapKeys {
+		encOpts.Sort = cbor.SortCanonical
+	}
+	if opts.CompactFloats {
+		encOpts.ShortestFloat = cbor.ShortestFloat16
+	}
+
+	mode, err := encOpts.EncMode()
+	if err != nil {
+		return nil, err
+	}
+	cborEncModes.Store(key, mode)
+	return mode, nil
+}
+
+// Marshal marshals inStruct to cbor.
+func (m *CBORSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to cbor using the given options.
+// SortMapKeys sorts map keys canonically and CompactFloats uses the shortest
+// float encoding preserving the value.
+func (m *CBORSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	mode, err := cborEncMode(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := mode.Marshal(inStruct)
+	return data, encodeError(err)
+}
+
+// Unmarshal unmarshals a raw cbor message to a struct.
+func (m *CBORSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(CBOR, err, -1)
+	}
+	return decodeError(CBOR, cbor.Unmarshal(rawBytes, outStruct), -1)
+}
+
+// Encode marshals the struct to a stream.
+func (m *CBORSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+func (m *CBORSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	mode, err := cborEncMode(opts)
+	if err != nil {
+		return err
+	}
+	return encodeError(mode.NewEncoder(w).Encode(inStruct))
+}
+
+// Decode unmarshals the struct from a stream.
+func (m *CBORSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+	return decodeError(CBOR, cbor.NewDecoder(r).Decode(outStruct), -1)
+}
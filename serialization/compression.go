@@ -0,0 +1,272 @@
+package serialization
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// Available compression codecs.
+const (
+	Gzip   = "gzip"
+	Zlib   = "zlib"
+	Snappy = "snappy"
+)
+
+// Compression defines a codec usable to compress serialized payloads.
+type Compression interface {
+	// Name is the suffix identifying the codec in a format, e.g. "gzip" in "application/json+gzip".
+	Name() string
+
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+
+	// Match returns whether the leading bytes of a payload were produced by the codec.
+	Match(header []byte) bool
+}
+
+// compressionHeaderSize is the number of leading bytes inspected to detect a codec.
+const compressionHeaderSize = 10
+
+// maxCompressedTrailer bounds what is read of a decompressed stream once
+// the wrapped serializer decoded its value.
+const maxCompressedTrailer = 64 << 10
+
+// compressions holds the codecs in registration order, the order in which
+// payloads are matched against them.
+var compressions = struct {
+	codecs []Compression
+	lock   sync.RWMutex
+}{
+	codecs: []Compression{
+		&gzipCompression{},
+		&zlibCompression{},
+		&snappyCompression{},
+	},
+}
+
+// RegisterCompression makes a compression codec available as a format suffix.
+// A codec registered under the name of another one replaces it.
+func RegisterCompression(c Compression) {
+	compressions.lock.Lock()
+	defer compressions.lock.Unlock()
+
+	for i, registered := range compressions.codecs {
+		if strings.EqualFold(registered.Name(), c.Name()) {
+			compressions.codecs[i] = c
+			return
+		}
+	}
+	compressions.codecs = append(compressions.codecs, c)
+}
+
+// LookupCompression returns the compression codec registered under a name.
+func LookupCompression(name string) (Compression, bool) {
+	compressions.lock.RLock()
+	defer compressions.lock.RUnlock()
+
+	for _, c := range compressions.codecs {
+		if strings.EqualFold(c.Name(), name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// detectCompression returns the first codec matching the leading bytes of a payload, if any.
+func detectCompression(header []byte) (Compression, bool) {
+	compressions.lock.RLock()
+	defer compressions.lock.RUnlock()
+
+	for _, c := range compressions.codecs {
+		if c.Match(header) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Compressed returns the variant of format compressed with the named codec,
+// e.g. Compressed(JSON, Gzip) is "application/json+gzip".
+func Compressed(format Format, compression string) Format {
+	return Format(string(format) + "+" + strings.ToLower(compression))
+}
+
+// splitCompression splits a compressed format into its inner format and codec.
+func splitCompression(format Format) (Format, Compression, bool) {
+	idx := strings.LastIndexByte(string(format), '+')
+	if idx < 0 {
+		return format, nil, false
+	}
+
+	c, ok := LookupCompression(string(format[idx+1:]))
+	if !ok {
+		return format, nil, false
+	}
+	return format[:idx], c, true
+}
+
+// CompressedSerializer wraps a serializer, compressing its output.
+// Decoding detects the compression from the payload header, so
+// uncompressed payloads and other registered codecs are accepted too.
+type CompressedSerializer struct {
+	Serializer  FormatSerializer
+	Compression Compression
+
+	// DecodeOptions are checked against the decompressed payload.
+	DecodeOptions DecodeOptions
+}
+
+// Marshal marshals and compresses inStruct.
+func (m *CompressedSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return marshalPooled(func(w io.Writer) error {
+		return m.Encode(inStruct, w)
+	})
+}
+
+// Unmarshal decompresses and unmarshals a raw message to a struct.
+func (m *CompressedSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return err
+	}
+
+	c, ok := detectCompression(rawBytes)
+	if !ok {
+		return m.Serializer.Unmarshal(rawBytes, outStruct)
+	}
+
+	reader, err := c.NewReader(bytes.NewReader(rawBytes))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := readDocument(reader, m.DecodeOptions)
+	if err != nil {
+		return err
+	}
+	return m.Serializer.Unmarshal(data, outStruct)
+}
+
+// Encode marshals the struct to a compressed stream.
+func (m *CompressedSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	writer, err := m.Compression.NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Serializer.Encode(inStruct, writer); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// Decode unmarshals the struct from a possibly compressed stream.
+func (m *CompressedSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+
+	// Peek returns fewer bytes on short streams, which simply won't match.
+	header, _ := buffered.Peek(compressionHeaderSize)
+
+	c, ok := detectCompression(header)
+	if !ok {
+		return m.Serializer.Decode(buffered, outStruct)
+	}
+
+	reader, err := c.NewReader(buffered)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := m.Serializer.Decode(reader, outStruct); err != nil {
+		return err
+	}
+
+	// Checksums trail the compressed data, they are only verified at the end of the stream.
+	return drainDecompressed(reader)
+}
+
+// drainDecompressed reads what the wrapped serializer left of a decompressed
+// stream. Only whitespace may remain, and at most maxCompressedTrailer bytes are read.
+func drainDecompressed(r io.Reader) error {
+	rest, err := ioutil.ReadAll(io.LimitReader(r, maxCompressedTrailer+1))
+	if err != nil {
+		return err
+	}
+	if len(rest) > maxCompressedTrailer || len(bytes.TrimSpace(rest)) > 0 {
+		return trailingDataError()
+	}
+	return nil
+}
+
+type gzipCompression struct{}
+
+func (c *gzipCompression) Name() string { return Gzip }
+
+func (c *gzipCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (c *gzipCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (c *gzipCompression) Match(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b
+}
+
+type zlibCompression struct{}
+
+func (c *zlibCompression) Name() string { return Zlib }
+
+func (c *zlibCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
+func (c *zlibCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+func (c *zlibCompression) Match(header []byte) bool {
+	// Deflate method with a 32K window, at one of the four standard levels (RFC 1950).
+	if len(header) < 2 || header[0] != 0x78 {
+		return false
+	}
+	switch header[1] {
+	case 0x01, 0x5e, 0x9c, 0xda:
+		return true
+	}
+	return false
+}
+
+type snappyCompression struct{}
+
+// snappyMagic is the stream identifier chunk opening every framed snappy stream.
+var snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+func (c *snappyCompression) Name() string { return Snappy }
+
+func (c *snappyCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (c *snappyCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(snappy.NewReader(r)), nil
+}
+
+func (c *snappyCompression) Match(header []byte) bool {
+	return bytes.HasPrefix(header, snappyMagic)
+}
@@ -0,0 +1,192 @@
+package serialization_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type compressedDocument struct {
+	Title string   `json:"title" msg:"title" yaml:"title"`
+	Lines []string `json:"lines" msg:"lines" yaml:"lines"`
+}
+
+func Test_CompressedRoundTrip(t *testing.T) {
+	in := compressedDocument{Title: "doc", Lines: []string{"a", "b", "c", "a", "b", "c"}}
+
+	for _, inner := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML} {
+		for _, codec := range []string{serialization.Gzip, serialization.Zlib, serialization.Snappy} {
+			format := serialization.Compressed(inner, codec)
+
+			t.Run(string(format), func(t *testing.T) {
+				data, err := serialization.Marshal(&in, format)
+				if err != nil {
+					t.Errorf("Marshal() error = %s", err.Error())
+					return
+				}
+
+				plain, _ := serialization.Marshal(&in, inner)
+				if bytes.Equal(data, plain) {
+					t.Error("payload was not compressed")
+				}
+
+				var out compressedDocument
+				if err := serialization.Unmarshal(data, &out, format); err != nil {
+					t.Errorf("Unmarshal() error = %s", err.Error())
+					return
+				}
+				if out.Title != in.Title || len(out.Lines) != len(in.Lines) {
+					t.Errorf("Unmarshal() = %+v", out)
+				}
+
+				var buf bytes.Buffer
+				if err := serialization.Encode(&in, &buf, format); err != nil {
+					t.Errorf("Encode() error = %s", err.Error())
+					return
+				}
+				out = compressedDocument{}
+				if err := serialization.Decode(&buf, &out, format); err != nil {
+					t.Errorf("Decode() error = %s", err.Error())
+					return
+				}
+				if out.Title != in.Title || len(out.Lines) != len(in.Lines) {
+					t.Errorf("Decode() = %+v", out)
+				}
+			})
+		}
+	}
+}
+
+func Test_CompressedDecodeDetectsCodec(t *testing.T) {
+	in := compressedDocument{Title: "doc"}
+
+	zlibbed, err := serialization.Marshal(&in, "application/json+zlib")
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+	plain, err := serialization.Marshal(&in, serialization.JSON)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	for _, data := range [][]byte{zlibbed, plain} {
+		var out compressedDocument
+		if err := serialization.Decode(bytes.NewReader(data), &out, "application/json+gzip"); err != nil {
+			t.Errorf("Decode() error = %s", err.Error())
+			continue
+		}
+		if out.Title != in.Title {
+			t.Errorf("Decode() = %+v", out)
+		}
+	}
+}
+
+func Test_CompressedChecksum(t *testing.T) {
+	in := compressedDocument{Title: "doc"}
+
+	for _, codec := range []string{serialization.Gzip, serialization.Zlib} {
+		format := serialization.Compressed(serialization.JSON, codec)
+
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(&in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			// Both gzip and zlib end with a checksum, gzip then appends the size.
+			checksum := len(data) - 1
+			if codec == serialization.Gzip {
+				checksum = len(data) - 5
+			}
+			data[checksum] ^= 0xff
+
+			var out compressedDocument
+			if err := serialization.Decode(bytes.NewReader(data), &out, format); err == nil {
+				t.Error("Decode() expected a checksum error")
+			}
+			if err := serialization.Unmarshal(data, &out, format); err == nil {
+				t.Error("Unmarshal() expected a checksum error")
+			}
+		})
+	}
+}
+
+func Test_CompressedResolve(t *testing.T) {
+	format, ok := serialization.Resolve("application/x-msgpack+GZIP")
+	if !ok || format != "application/msgpack+gzip" {
+		t.Errorf("Resolve() = %s, %v", format, ok)
+	}
+
+	if _, ok := serialization.Lookup("application/unknown+gzip"); ok {
+		t.Error("compressed variant of an unknown format should not resolve")
+	}
+}
+
+func Test_CompressedTrailingData(t *testing.T) {
+	doc, err := serialization.Marshal(&compressedDocument{Title: "doc"}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	// The wrapped decoder buffers what it reads, trailing data must exceed its buffer.
+	tests := map[string][]byte{
+		"garbage": append(append([]byte(nil), doc...), bytes.Repeat([]byte("garbage "), 4<<10)...),
+		"bomb":    append(append([]byte(nil), doc...), make([]byte, 1<<20)...),
+	}
+	for name, payload := range tests {
+		t.Run(name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			writer.Write(payload)
+			writer.Close()
+
+			var out compressedDocument
+			err := serialization.Decode(&compressed, &out, serialization.Compressed(serialization.MsgPack, serialization.Gzip))
+			if _, ok := err.(*serialization.FieldError); !ok {
+				t.Errorf("Decode() error = %v, want a trailing data error", err)
+			}
+		})
+	}
+}
+
+// gzipImpostor matches gzip payloads but can't decompress them.
+type gzipImpostor struct{}
+
+func (c *gzipImpostor) Name() string { return "impostor" }
+func (c *gzipImpostor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("impostor")
+}
+func (c *gzipImpostor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return nil, errors.New("impostor")
+}
+func (c *gzipImpostor) Match(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b
+}
+
+func Test_CompressedDetectionOrder(t *testing.T) {
+	serialization.RegisterCompression(&gzipImpostor{})
+
+	format := serialization.Compressed(serialization.JSON, serialization.Gzip)
+	data, err := serialization.Marshal(&compressedDocument{Title: "doc"}, format)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	// Codecs are matched in registration order, so gzip always wins.
+	for i := 0; i < 20; i++ {
+		var out compressedDocument
+		if err := serialization.Unmarshal(data, &out, format); err != nil {
+			t.Errorf("Unmarshal() error = %s", err.Error())
+			return
+		}
+	}
+}
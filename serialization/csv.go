@@ -0,0 +1,546 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	bytesType         = reflect.TypeOf([]byte(nil))
+)
+
+// CSVSerializer serializes slices of structs to csv, one row per element.
+//
+// The header row holds the column names, taken from the csv tag of each
+// field, falling back to the json tag. Fields of nested structs are
+// flattened into dotted columns (e.g. "server.host"). Cells hold the text
+// form of scalars, times and encoding.TextMarshaler values, base64 for byte
+// slices and json for anything else. Empty cells decode to zero values.
+//
+// Decoding accepts a pointer to a slice, or to a struct to read the first row.
+// Columns matching no field are ignored, unless DecodeOptions disallow them.
+// The decoder applies DecodeOptions itself: rows and the columns of a row are
+// collections, each cell is a string and records are nested at depth 2.
+type CSVSerializer struct {
+	// Comma is the field delimiter, ',' when zero.
+	Comma rune
+
+	DecodeOptions DecodeOptions
+}
+
+func (m *CSVSerializer) comma() rune {
+	if m.Comma == 0 {
+		return ','
+	}
+	return m.Comma
+}
+
+// Marshal marshals inStruct to csv.
+func (m *CSVSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return marshalPooled(func(w io.Writer) error {
+		return m.Encode(inStruct, w)
+	})
+}
+
+// Unmarshal unmarshals raw csv to a slice of structs.
+func (m *CSVSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkSize(rawBytes, m.DecodeOptions); err != nil {
+		return err
+	}
+	return m.decode(bytes.NewReader(rawBytes), outStruct)
+}
+
+func (m *CSVSerializer) unmarshalWithOptions(data []byte, outStruct interface{}, opts DecodeOptions) error {
+	s := *m
+	s.DecodeOptions = opts
+	return s.Unmarshal(data, outStruct)
+}
+
+// Encode writes the header and rows of a slice of structs, or of a single struct, to a stream.
+func (m *CSVSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	v := reflect.ValueOf(inStruct)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	encoder := &csvRecordEncoder{writer: m.newWriter(w)}
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if err := encoder.writeHeader(v.Type().Elem()); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encoder.Encode(v.Index(i).Interface()); err != nil {
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+		}
+	default:
+		if err := encoder.Encode(inStruct); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// Decode reads the rows of a stream into a slice of structs, or the first row into a struct.
+func (m *CSVSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if m.DecodeOptions.MaxBytes > 0 {
+		data, err := readDocument(r, m.DecodeOptions)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	return m.decode(r, outStruct)
+}
+
+func (m *CSVSerializer) decode(r io.Reader, outStruct interface{}) error {
+	out := reflect.ValueOf(outStruct)
+	if out.Kind() != reflect.Ptr || out.IsNil() {
+		return &UnsupportedTypeError{Type: reflect.TypeOf(outStruct), Reason: "outStruct must be a non-nil pointer"}
+	}
+
+	decoder := m.NewRecordDecoder(r)
+	target := out.Elem()
+	if target.Kind() != reflect.Slice {
+		if err := decoder.Next(); err != nil {
+			return err
+		}
+		return decoder.Decode(outStruct)
+	}
+
+	rows := reflect.MakeSlice(target.Type(), 0, 0)
+	for {
+		if err := decoder.Next(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		row := reflect.New(target.Type().Elem())
+		if err := decoder.Decode(row.Interface()); err != nil {
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				// Other errors carry their own path.
+				return err
+			}
+			return withPath(CSV, err, fmt.Sprintf("[%d]", rows.Len()))
+		}
+		rows = reflect.Append(rows, row.Elem())
+	}
+	target.Set(rows)
+	return nil
+}
+
+// typedOnly marks CSV as having no generic representation.
+func (m *CSVSerializer) typedOnly() {}
+
+func (m *CSVSerializer) newWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = m.comma()
+	return writer
+}
+
+// NewRecordEncoder returns an encoder writing one row per record, preceded by
+// the header of the first record. Close must be called to flush the rows.
+func (m *CSVSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	return &csvRecordEncoder{writer: m.newWriter(w)}
+}
+
+// NewRecordDecoder returns a decoder reading one record per row, after the header.
+// Rows are checked against the DecodeOptions of the serializer, except MaxBytes.
+func (m *CSVSerializer) NewRecordDecoder(r io.Reader) RecordDecoder {
+	reader := csv.NewReader(r)
+	reader.Comma = m.comma()
+	reader.ReuseRecord = true
+	return &csvRecordDecoder{reader: reader, opts: m.DecodeOptions, limits: m.DecodeOptions.limits()}
+}
+
+type csvRecordEncoder struct {
+	writer  *csv.Writer
+	typ     reflect.Type
+	columns []csvColumn
+	row     []string
+}
+
+func (e *csvRecordEncoder) writeHeader(t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return &UnsupportedTypeError{Type: t, Reason: "csv records must be structs"}
+	}
+
+	e.typ = t
+	e.columns = cachedColumns(t)
+	e.row = make([]string, len(e.columns))
+
+	for i, column := range e.columns {
+		e.row[i] = column.name
+	}
+	return e.writer.Write(e.row)
+}
+
+func (e *csvRecordEncoder) Encode(inStruct interface{}) error {
+	v := reflect.ValueOf(inStruct)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors.New("csv: nil record")
+		}
+		v = v.Elem()
+	}
+
+	if e.typ == nil {
+		if err := e.writeHeader(v.Type()); err != nil {
+			return err
+		}
+	}
+	if v.Type() != e.typ {
+		return fmt.Errorf("csv: record type %s differs from header type %s", v.Type(), e.typ)
+	}
+
+	for i, column := range e.columns {
+		cell, ok := fieldByIndex(v, column.index)
+		if !ok {
+			e.row[i] = ""
+			continue
+		}
+
+		text, err := formatCell(cell)
+		if err != nil {
+			return fmt.Errorf("%s: %w", column.name, err)
+		}
+		e.row[i] = text
+	}
+	return e.writer.Write(e.row)
+}
+
+// Close flushes the rows buffered by the encoder.
+func (e *csvRecordEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type csvRecordDecoder struct {
+	reader *csv.Reader
+	header []string
+	row    []string
+	rows   int
+
+	opts   DecodeOptions
+	limits limits
+
+	typ     reflect.Type
+	columns []*csvColumn
+}
+
+func (d *csvRecordDecoder) Next() error {
+	if d.header == nil {
+		header, err := d.reader.Read()
+		if err != nil {
+			return decodeError(CSV, err, -1)
+		}
+		d.header = append([]string(nil), header...)
+		if err := d.checkHeader(); err != nil {
+			return err
+		}
+	}
+
+	row, err := d.reader.Read()
+	if err != nil {
+		d.row = nil
+		return decodeError(CSV, err, -1)
+	}
+	d.row = row
+	d.rows++
+	return d.checkRow()
+}
+
+// checkHeader checks the column names against the decode options.
+func (d *csvRecordDecoder) checkHeader() error {
+	seen := make(map[string]bool, len(d.header))
+	for _, name := range d.header {
+		if err := d.limits.checkString(len(name), name); err != nil {
+			return err
+		}
+		if d.opts.DisallowDuplicateKeys && seen[name] {
+			return &FieldError{Path: name, Reason: "duplicate key"}
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// checkRow checks the current row against the structural limits.
+func (d *csvRecordDecoder) checkRow() error {
+	if !d.limits.enabled() {
+		return nil
+	}
+
+	path := indexPath("", d.rows-1)
+	if err := d.limits.checkDepth(2, path); err != nil {
+		return err
+	}
+	if err := d.limits.checkLength(d.rows, ""); err != nil {
+		return err
+	}
+	if err := d.limits.checkLength(len(d.row), path); err != nil {
+		return err
+	}
+	for i, cell := range d.row {
+		name := strconv.Itoa(i)
+		if i < len(d.header) {
+			name = d.header[i]
+		}
+		if err := d.limits.checkString(len(cell), joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *csvRecordDecoder) Decode(outStruct interface{}) error {
+	if d.row == nil {
+		return errors.New("no current csv row")
+	}
+
+	v := reflect.ValueOf(outStruct)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &UnsupportedTypeError{Type: reflect.TypeOf(outStruct), Reason: "outStruct must be a non-nil pointer"}
+	}
+	v = v.Elem()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return &UnsupportedTypeError{Type: v.Type(), Reason: "csv records must be structs"}
+	}
+
+	if v.Type() != d.typ {
+		d.typ = v.Type()
+		d.columns = matchColumns(d.header, cachedColumns(d.typ))
+	}
+	if err := d.checkColumns(); err != nil {
+		return err
+	}
+
+	for i, column := range d.columns {
+		if column == nil || i >= len(d.row) || d.row[i] == "" {
+			continue
+		}
+		cell, err := fieldByIndexAlloc(v, column.index)
+		if err == nil {
+			err = parseCell(cell, d.row[i])
+		}
+		if err != nil {
+			return withPath(CSV, err, column.name)
+		}
+	}
+	return nil
+}
+
+// checkColumns checks the current row against the fields of the record type.
+func (d *csvRecordDecoder) checkColumns() error {
+	if d.opts.DisallowUnknownFields {
+		for i, column := range d.columns {
+			if column == nil {
+				return &FieldError{Path: d.header[i], Reason: "unknown field"}
+			}
+		}
+	}
+
+	if d.opts.CheckRequired {
+		// Empty cells decode to zero values, so a required column must hold a value.
+		present := make(map[string]bool, len(d.columns))
+		for i, column := range d.columns {
+			if column != nil && i < len(d.row) && d.row[i] != "" {
+				present[column.name] = true
+			}
+		}
+		for _, column := range cachedColumns(d.typ) {
+			if column.required && !present[column.name] {
+				return &FieldError{Path: joinPath(indexPath("", d.rows-1), column.name), Reason: "missing required field"}
+			}
+		}
+	}
+	return nil
+}
+
+// csvColumn is a leaf field of a record, possibly nested in other structs.
+type csvColumn struct {
+	name     string
+	index    []int
+	required bool
+}
+
+var (
+	csvTags        = []string{"csv", "json"}
+	csvColumnCache sync.Map
+)
+
+func cachedColumns(t reflect.Type) []csvColumn {
+	if columns, ok := csvColumnCache.Load(t); ok {
+		return columns.([]csvColumn)
+	}
+
+	columns := typeColumns(t, "", nil, map[reflect.Type]bool{t: true})
+	csvColumnCache.Store(t, columns)
+	return columns
+}
+
+// isTextual returns whether values of the type have their own text form.
+func isTextual(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+func typeColumns(t reflect.Type, prefix string, index []int, parents map[reflect.Type]bool) []csvColumn {
+	var columns []csvColumn
+
+	for _, f := range cachedFields(t, csvTags...) {
+		fieldIndex := append(append([]int(nil), index...), f.Index...)
+		name := prefix + f.Name
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// Nested structs are flattened, except recursive ones which are stored as json.
+		if ft.Kind() == reflect.Struct && !isTextual(ft) && !parents[ft] {
+			parents[ft] = true
+			columns = append(columns, typeColumns(ft, name+".", fieldIndex, parents)...)
+			delete(parents, ft)
+			continue
+		}
+		columns = append(columns, csvColumn{name: name, index: fieldIndex, required: f.Required})
+	}
+	return columns
+}
+
+// matchColumns returns the column of each header name, nil for unknown names.
+func matchColumns(header []string, columns []csvColumn) []*csvColumn {
+	matched := make([]*csvColumn, len(header))
+	for i, name := range header {
+		for j := range columns {
+			if columns[j].name == name {
+				matched[i] = &columns[j]
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func formatCell(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if isTextual(v.Type()) {
+		marshaler, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok {
+			if !v.CanAddr() {
+				copied := reflect.New(v.Type())
+				copied.Elem().Set(v)
+				v = copied.Elem()
+			}
+			marshaler = v.Addr().Interface().(encoding.TextMarshaler)
+		}
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+
+	if v.Type() == bytesType {
+		return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+	}
+
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
+
+func parseCell(v reflect.Value, text string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return parseCell(v.Elem(), text)
+	}
+
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	if v.Type() == bytesType {
+		data, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(data)
+		return nil
+	}
+	return json.Unmarshal([]byte(text), v.Addr().Interface())
+}
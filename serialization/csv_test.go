@@ -0,0 +1,238 @@
+package serialization_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/serialization"
+)
+
+type csvServer struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type csvRecord struct {
+	ID      uint64            `csv:"id" json:"identifier"`
+	Name    string            `json:"name"`
+	Score   float64           `json:"score"`
+	Active  bool              `json:"active"`
+	Created time.Time         `json:"created"`
+	Server  csvServer         `json:"server"`
+	Backup  *csvServer        `json:"backup"`
+	Labels  map[string]string `json:"labels"`
+	Secret  []byte            `json:"secret"`
+	Skipped string            `json:"-"`
+}
+
+func newCSVRecords() []csvRecord {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	return []csvRecord{
+		{ID: 1, Name: "first, with comma", Score: 1.5, Active: true, Created: created, Server: csvServer{"a", 1}, Labels: map[string]string{"k": "v"}, Secret: []byte{1, 2}},
+		{ID: 2, Name: "second \"quoted\"\nmultiline", Created: created, Server: csvServer{"b", 2}, Backup: &csvServer{"c", 3}},
+	}
+}
+
+func Test_CSV_MarshalUnmarshal(t *testing.T) {
+	in := newCSVRecords()
+
+	data, err := serialization.Marshal(in, serialization.CSV)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	header := strings.SplitN(string(data), "\n", 2)[0]
+	expectedHeader := "id,name,score,active,created,server.host,server.port,backup.host,backup.port,labels,secret"
+	if header != expectedHeader {
+		t.Errorf("header = %s, want %s", header, expectedHeader)
+	}
+
+	var out []csvRecord
+	if err := serialization.Unmarshal(data, &out, serialization.CSV); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	for i := range out {
+		if !out[i].Created.Equal(in[i].Created) {
+			t.Errorf("Unmarshal() created = %s, want %s", out[i].Created, in[i].Created)
+		}
+		out[i].Created = in[i].Created
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+}
+
+func Test_TSV_EncodeDecode(t *testing.T) {
+	in := []*csvServer{{"a", 1}, {"b", 2}}
+
+	var buf bytes.Buffer
+	if err := serialization.Encode(in, &buf, serialization.TSV); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+	if buf.String() != "host\tport\na\t1\nb\t2\n" {
+		t.Errorf("Encode() = %q", buf.String())
+	}
+
+	var out []*csvServer
+	if err := serialization.Decode(&buf, &out, serialization.TSV); err != nil {
+		t.Errorf("Decode() error = %s", err.Error())
+		return
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Decode() = %v, want %v", out, in)
+	}
+}
+
+func Test_CSV_Decode(t *testing.T) {
+	data := "port,unknown,host\n80,x,a\n,y,b\n"
+
+	var out []csvServer
+	if err := serialization.Unmarshal([]byte(data), &out, serialization.CSV); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	expected := []csvServer{{"a", 80}, {"b", 0}}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Unmarshal() = %v, want %v", out, expected)
+	}
+
+	var first csvServer
+	if err := serialization.Unmarshal([]byte(data), &first, serialization.CSV); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	if first != expected[0] {
+		t.Errorf("Unmarshal() = %v, want %v", first, expected[0])
+	}
+
+	if err := serialization.Unmarshal([]byte("port\nnot-a-number\n"), &out, serialization.CSV); err == nil {
+		t.Errorf("Unmarshal() expected error")
+	}
+}
+
+func Test_CSV_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := serialization.NewStreamEncoder(&buf, serialization.CSV)
+	if err != nil {
+		t.Errorf("NewStreamEncoder() error = %s", err.Error())
+		return
+	}
+	for i := 0; i < 100; i++ {
+		if err := encoder.Encode(csvServer{Host: "h", Port: i}); err != nil {
+			t.Errorf("Encode() error = %s", err.Error())
+			return
+		}
+	}
+	if err := encoder.Encode(csvRecord{}); err == nil {
+		t.Errorf("Encode() expected error for a different record type")
+	}
+	if err := encoder.Close(); err != nil {
+		t.Errorf("Close() error = %s", err.Error())
+		return
+	}
+
+	decoder, err := serialization.NewStreamDecoder(&buf, serialization.CSV)
+	if err != nil {
+		t.Errorf("NewStreamDecoder() error = %s", err.Error())
+		return
+	}
+	for i := 0; ; i++ {
+		var row csvServer
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			if i != 100 {
+				t.Errorf("decoded %d rows, want 100", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Errorf("Decode() error = %s", err.Error())
+			return
+		}
+		if row.Port != i {
+			t.Errorf("row %d: port = %d", i, row.Port)
+		}
+	}
+}
+
+type csvRequired struct {
+	Host string `json:"host" serialization:"required"`
+	Port int    `json:"port"`
+}
+
+func Test_CSV_DecodeOptions(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.CSV, serialization.TSV} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(newCSVRecords(), format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out []csvRecord
+			if err := serialization.UnmarshalWithOptions(data, &out, format, serialization.StrictDecoding); err != nil {
+				t.Errorf("UnmarshalWithOptions() error = %s", err.Error())
+				return
+			}
+			if !reflect.DeepEqual(out, newCSVRecords()) {
+				t.Errorf("UnmarshalWithOptions() = %+v", out)
+			}
+
+			opts := serialization.DecodeOptions{MaxBytes: 1 << 20, MaxDepth: 2, MaxCollectionLength: 20, MaxStringLength: 64}
+			if err := serialization.DecodeWithOptions(bytes.NewReader(data), &out, format, opts); err != nil {
+				t.Errorf("DecodeWithOptions() error = %s", err.Error())
+			}
+		})
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		opts     serialization.DecodeOptions
+		wantPath string
+	}{
+		{"unknown column", "host,prot\na,1\n", serialization.DecodeOptions{DisallowUnknownFields: true}, "prot"},
+		{"duplicate column", "host,host\na,b\n", serialization.DecodeOptions{DisallowDuplicateKeys: true}, "host"},
+		{"missing required", "host,port\na,1\n,2\n", serialization.DecodeOptions{CheckRequired: true}, "[1].host"},
+		{"missing required column", "port\n1\n", serialization.DecodeOptions{CheckRequired: true}, "[0].host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []csvRequired
+			err := serialization.UnmarshalWithOptions([]byte(tt.data), &out, serialization.CSV, tt.opts)
+			fieldErr, ok := err.(*serialization.FieldError)
+			if !ok || fieldErr.Path != tt.wantPath {
+				t.Errorf("UnmarshalWithOptions() error = %v, want a field error at %s", err, tt.wantPath)
+			}
+		})
+	}
+
+	limits := []struct {
+		name  string
+		opts  serialization.DecodeOptions
+		limit serialization.Limit
+	}{
+		{"rows", serialization.DecodeOptions{MaxCollectionLength: 2}, serialization.LimitCollectionLength},
+		{"cell", serialization.DecodeOptions{MaxStringLength: 4}, serialization.LimitStringLength},
+		{"depth", serialization.DecodeOptions{MaxDepth: 1}, serialization.LimitDepth},
+		{"size", serialization.DecodeOptions{MaxBytes: 8}, serialization.LimitBytes},
+	}
+	for _, tt := range limits {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &serialization.CSVSerializer{DecodeOptions: tt.opts}
+
+			var out []csvRequired
+			limitErr, ok := s.Unmarshal([]byte("host,port\na,1\nb,2\nlonger,3\n"), &out).(*serialization.LimitError)
+			if !ok || limitErr.Limit != tt.limit {
+				t.Errorf("Unmarshal() error = %v, want a %s limit error", limitErr, tt.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pelletier/go-toml"
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// Sniffer is implemented by serializers able to recognize their own payloads.
+// Sniff returns a confidence between 0 (not this format) and 100 (certainly this format).
+type Sniffer interface {
+	Sniff(data []byte) int
+}
+
+// AmbiguousFormatError is returned when several formats match a payload equally well.
+type AmbiguousFormatError struct {
+	Candidates []Format
+}
+
+func (e *AmbiguousFormatError) Error() string {
+	candidates := make([]string, len(e.Candidates))
+	for i, c := range e.Candidates {
+		candidates[i] = string(c)
+	}
+	return fmt.Sprintf("ambiguous format, candidates: %s", strings.Join(candidates, ", "))
+}
+
+// RegisterExtension associates a file extension (with or without the leading dot) to a format.
+func RegisterExtension(ext string, format Format) {
+	defaultRegistry.lock.Lock()
+	defer defaultRegistry.lock.Unlock()
+
+	defaultRegistry.extensions[normalizeExtension(ext)] = normalize(format)
+}
+
+func normalizeExtension(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// DetectName returns the format associated with the extension of a file name.
+func DetectName(name string) (Format, bool) {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	format, ok := defaultRegistry.extensions[normalizeExtension(filepath.Ext(name))]
+	if !ok {
+		return "", false
+	}
+	return defaultRegistry.resolve(format)
+}
+
+// Detect identifies the format of a payload by sniffing its bytes
+// with every registered serializer implementing Sniffer.
+func Detect(data []byte) (Format, error) {
+	var (
+		candidates []Format
+		best       int
+	)
+
+	for _, format := range Formats() {
+		serializer, ok := Lookup(format)
+		if !ok {
+			continue
+		}
+		sniffer, ok := serializer.(Sniffer)
+		if !ok {
+			continue
+		}
+
+		confidence := sniffer.Sniff(data)
+		switch {
+		case confidence <= 0 || confidence < best:
+		case confidence > best:
+			best, candidates = confidence, []Format{format}
+		default:
+			candidates = append(candidates, format)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("unable to detect format")
+	case 1:
+		return candidates[0], nil
+	}
+	return "", &AmbiguousFormatError{Candidates: candidates}
+}
+
+// DetectFile identifies the format of a file payload, using the extension
+// of its name first and sniffing its bytes otherwise.
+func DetectFile(name string, data []byte) (Format, error) {
+	if format, ok := DetectName(name); ok {
+		return format, nil
+	}
+	return Detect(data)
+}
+
+// UnmarshalAuto detects the format of data and loads it into the struct,
+// returning the detected format.
+func UnmarshalAuto(data []byte, outStruct interface{}) (Format, error) {
+	format, err := Detect(data)
+	if err != nil {
+		return "", err
+	}
+	return format, Unmarshal(data, outStruct, format)
+}
+
+// DecodeAuto reads the whole stream, detects its format and decodes it into
+// the struct, returning the detected format.
+func DecodeAuto(r io.Reader, outStruct interface{}) (Format, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return UnmarshalAuto(data, outStruct)
+}
+
+// Sniff recognizes JSON documents.
+func (m *JSONSerializer) Sniff(data []byte) int {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return 0
+	}
+
+	if json.Valid(trimmed) {
+		switch trimmed[0] {
+		case '{', '[':
+			return 90
+		}
+		return 30
+	}
+
+	// Truncated payloads are still likely JSON if they open an object.
+	if trimmed[0] == '{' && bytes.HasPrefix(bytes.TrimSpace(trimmed[1:]), []byte{'"'}) {
+		return 40
+	}
+	return 0
+}
+
+// Sniff recognizes msgpack objects.
+func (m *MsgpackSerializer) Sniff(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+
+	rest, err := msgp.Skip(data)
+	if err != nil || len(rest) != 0 {
+		return 0
+	}
+
+	switch msgp.NextType(data) {
+	case msgp.MapType, msgp.ArrayType:
+		if data[0] >= 0x80 {
+			return 90
+		}
+	}
+
+	if utf8.Valid(data) && isText(data) {
+		// Scalars encoded as a single ASCII byte are more likely text.
+		return 10
+	}
+	return 50
+}
+
+// Sniff recognizes YAML documents. Most text parses as a YAML scalar, so a
+// document must start with a directive or "---", or hold a collection.
+func (m *YAMLSerializer) Sniff(data []byte) int {
+	if len(bytes.TrimSpace(data)) == 0 || !utf8.Valid(data) || !isText(data) {
+		return 0
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return 0
+	}
+
+	if bytes.HasPrefix(data, []byte("---")) || bytes.HasPrefix(data, []byte("%YAML")) {
+		return 80
+	}
+	if len(node.Content) > 0 {
+		switch node.Content[0].Kind {
+		case yaml.MappingNode, yaml.SequenceNode:
+			if node.Content[0].Style&yaml.FlowStyle == 0 {
+				return 70
+			}
+			return 20
+		}
+	}
+	return 0
+}
+
+// Sniff recognizes CBOR collections, and payloads starting with the self-described CBOR tag.
+func (m *CBORSerializer) Sniff(data []byte) int {
+	if len(data) == 0 || cbor.Wellformed(data) != nil {
+		return 0
+	}
+
+	if bytes.HasPrefix(data, []byte{0xd9, 0xd9, 0xf7}) {
+		return 100
+	}
+	switch data[0] >> 5 {
+	case 4, 5:
+		// Arrays and maps. Well-formed msgpack collections are more likely msgpack.
+		return 85
+	}
+	return 0
+}
+
+// Sniff recognizes TOML documents defining at least one key.
+func (m *TOMLSerializer) Sniff(data []byte) int {
+	if !utf8.Valid(data) || !isText(data) {
+		return 0
+	}
+
+	tree, err := toml.LoadBytes(data)
+	if err != nil || len(tree.Keys()) == 0 {
+		return 0
+	}
+	return 60
+}
+
+// Sniff recognizes XML documents, made of a single root element.
+func (m *XMLSerializer) Sniff(data []byte) int {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '<' {
+		return 0
+	}
+
+	if roots, err := countXMLRoots(trimmed); err != nil || roots != 1 {
+		return 0
+	}
+	return 90
+}
+
+// isText returns whether data is made of printable characters and whitespace.
+func isText(data []byte) bool {
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
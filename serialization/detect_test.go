@@ -0,0 +1,97 @@
+package serialization_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type detectSample struct {
+	Name string `json:"name" yaml:"name" msg:"name"`
+	Size int    `json:"size" yaml:"size" msg:"size"`
+}
+
+func Test_Detect(t *testing.T) {
+	sample := detectSample{Name: "sample", Size: 3}
+
+	for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(&sample, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			detected, err := serialization.Detect(data)
+			if err != nil {
+				t.Errorf("Detect() error = %s", err.Error())
+				return
+			}
+			if detected != format {
+				t.Errorf("Detect() = %s, want %s", detected, format)
+			}
+
+			var out detectSample
+			detected, err = serialization.DecodeAuto(bytes.NewReader(data), &out)
+			if err != nil {
+				t.Errorf("DecodeAuto() error = %s", err.Error())
+				return
+			}
+			if detected != format || out != sample {
+				t.Errorf("DecodeAuto() = %s, %+v", detected, out)
+			}
+		})
+	}
+}
+
+func Test_DetectFailure(t *testing.T) {
+	if _, err := serialization.Detect([]byte{0xc1}); err == nil {
+		t.Error("expected an error for an unknown payload")
+	}
+	if format, err := serialization.Detect([]byte("just some plain text\n")); err == nil {
+		t.Errorf("Detect() = %s, expected an error for plain text", format)
+	}
+}
+
+type alwaysSniffer struct {
+	upperSerializer
+}
+
+func (a *alwaysSniffer) Sniff([]byte) int { return 100 }
+
+func Test_DetectAmbiguous(t *testing.T) {
+	serialization.Register("application/x-first", &alwaysSniffer{})
+	serialization.Register("application/x-second", &alwaysSniffer{})
+	defer serialization.Unregister("application/x-first")
+	defer serialization.Unregister("application/x-second")
+
+	_, err := serialization.Detect([]byte(`{"a": 1}`))
+
+	ambiguous, ok := err.(*serialization.AmbiguousFormatError)
+	if !ok {
+		t.Errorf("Detect() error = %v, want AmbiguousFormatError", err)
+		return
+	}
+	if len(ambiguous.Candidates) != 2 {
+		t.Errorf("candidates = %v", ambiguous.Candidates)
+	}
+}
+
+func Test_DetectName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   serialization.Format
+		wantOk bool
+	}{
+		{"config.yml", serialization.YAML, true},
+		{"/tmp/dump.JSON", serialization.JSON, true},
+		{"cache.msgpack", serialization.MsgPack, true},
+		{"notes.txt", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := serialization.DetectName(tt.name); got != tt.want || ok != tt.wantOk {
+			t.Errorf("DetectName(%s) = %s, %v, want %s, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
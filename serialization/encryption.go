@@ -0,0 +1,280 @@
+package serialization
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Cipher identifies an authenticated encryption algorithm.
+type Cipher byte
+
+// Available ciphers.
+const (
+	AESGCM Cipher = iota + 1
+	ChaCha20Poly1305
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case AESGCM:
+		return "aes-gcm"
+	case ChaCha20Poly1305:
+		return "chacha20-poly1305"
+	}
+	return fmt.Sprintf("cipher(%d)", byte(c))
+}
+
+func (c Cipher) aead(key []byte) (cipher.AEAD, error) {
+	switch c {
+	case AESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	}
+	return nil, fmt.Errorf("unknown cipher: %s", c)
+}
+
+// Envelope errors.
+var (
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	ErrUnknownKey      = errors.New("unknown key")
+)
+
+// envelopeMagic opens every encrypted envelope.
+var envelopeMagic = []byte("GENC")
+
+const envelopeVersion = 1
+
+// KeyProvider supplies the keys used to seal and open envelopes.
+type KeyProvider interface {
+	// CurrentKey returns the key used to seal new envelopes, along with its ID.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given ID, used to open existing envelopes.
+	Key(id string) ([]byte, error)
+}
+
+// KeyRing is an in-memory KeyProvider supporting key rotation:
+// new envelopes are sealed with the current key while envelopes
+// sealed with any previously added key remain decodable.
+type KeyRing struct {
+	current string
+	keys    map[string][]byte
+
+	lock sync.RWMutex
+}
+
+// NewKeyRing returns a key ring using the given key as its current key.
+func NewKeyRing(id string, key []byte) *KeyRing {
+	r := &KeyRing{keys: make(map[string][]byte)}
+	r.Rotate(id, key)
+	return r
+}
+
+// Add makes a key available to open envelopes, without sealing new ones with it.
+func (r *KeyRing) Add(id string, key []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keys[id] = key
+}
+
+// Rotate adds a key and makes it the current key.
+func (r *KeyRing) Rotate(id string, key []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keys[id] = key
+	r.current = id
+}
+
+// Remove forgets a key. Envelopes sealed with it can no longer be opened.
+func (r *KeyRing) Remove(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.keys, id)
+}
+
+// CurrentKey returns the current key and its ID.
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	key, ok := r.keys[r.current]
+	if !ok {
+		return "", nil, ErrUnknownKey
+	}
+	return r.current, key, nil
+}
+
+// Key returns the key with the given ID.
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// EncryptedSerializer seals payloads serialized in Format in an authenticated
+// envelope. The envelope header records the cipher, key ID, nonce and inner
+// format, so envelopes remain decodable after key rotation or format changes.
+type EncryptedSerializer struct {
+	Format Format
+	Cipher Cipher
+	Keys   KeyProvider
+}
+
+type envelopeHeader struct {
+	cipher Cipher
+	keyID  string
+	format Format
+	nonce  []byte
+}
+
+func (h *envelopeHeader) marshal() ([]byte, error) {
+	if len(h.keyID) > 255 || len(h.format) > 255 || len(h.nonce) > 255 {
+		return nil, errors.New("envelope header field too long")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.WriteByte(envelopeVersion)
+	buf.WriteByte(byte(h.cipher))
+	for _, field := range [][]byte{[]byte(h.keyID), []byte(h.format), h.nonce} {
+		buf.WriteByte(byte(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalEnvelopeHeader parses the header, returning it along with its size.
+func unmarshalEnvelopeHeader(data []byte) (*envelopeHeader, int, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) || len(data) < len(envelopeMagic)+2 {
+		return nil, 0, ErrInvalidEnvelope
+	}
+
+	offset := len(envelopeMagic)
+	if data[offset] != envelopeVersion {
+		return nil, 0, fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, data[offset])
+	}
+
+	h := &envelopeHeader{cipher: Cipher(data[offset+1])}
+	offset += 2
+
+	var fields [3][]byte
+	for i := range fields {
+		if offset >= len(data) {
+			return nil, 0, ErrInvalidEnvelope
+		}
+		size := int(data[offset])
+		offset++
+		if offset+size > len(data) {
+			return nil, 0, ErrInvalidEnvelope
+		}
+		fields[i] = data[offset : offset+size]
+		offset += size
+	}
+
+	h.keyID, h.format, h.nonce = string(fields[0]), Format(fields[1]), fields[2]
+	return h, offset, nil
+}
+
+// Marshal serializes and seals inStruct.
+func (m *EncryptedSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	plaintext, err := Marshal(inStruct, m.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, key, err := m.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := m.Cipher.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &envelopeHeader{
+		cipher: m.Cipher,
+		keyID:  keyID,
+		format: m.Format,
+		nonce:  make([]byte, aead.NonceSize()),
+	}
+	if _, err := io.ReadFull(rand.Reader, h.nonce); err != nil {
+		return nil, err
+	}
+
+	header, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is authenticated along with the payload.
+	return aead.Seal(header, h.nonce, plaintext, header), nil
+}
+
+// Unmarshal opens an envelope and unmarshals its payload to a struct.
+func (m *EncryptedSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	h, size, err := unmarshalEnvelopeHeader(rawBytes)
+	if err != nil {
+		return err
+	}
+
+	key, err := m.Keys.Key(h.keyID)
+	if err != nil {
+		return err
+	}
+
+	aead, err := h.cipher.aead(key)
+	if err != nil {
+		return err
+	}
+	if len(h.nonce) != aead.NonceSize() {
+		return ErrInvalidEnvelope
+	}
+
+	plaintext, err := aead.Open(nil, h.nonce, rawBytes[size:], rawBytes[:size])
+	if err != nil {
+		return ErrInvalidEnvelope
+	}
+	return Unmarshal(plaintext, outStruct, h.format)
+}
+
+// Encode seals the struct and writes the envelope to a stream.
+func (m *EncryptedSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	data, err := m.Marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode reads a whole envelope from the stream and unmarshals its payload.
+func (m *EncryptedSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(data, outStruct)
+}
@@ -0,0 +1,108 @@
+package serialization_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type credentials struct {
+	User     string `json:"user" msg:"user"`
+	Password string `json:"password" msg:"password"`
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func Test_EncryptedRoundTrip(t *testing.T) {
+	in := credentials{User: "admin", Password: "hunter2"}
+
+	for _, cipher := range []serialization.Cipher{serialization.AESGCM, serialization.ChaCha20Poly1305} {
+		t.Run(cipher.String(), func(t *testing.T) {
+			s := &serialization.EncryptedSerializer{
+				Format: serialization.MsgPack,
+				Cipher: cipher,
+				Keys:   serialization.NewKeyRing("k1", testKey(1)),
+			}
+
+			var buf bytes.Buffer
+			if err := s.Encode(&in, &buf); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+			if bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+				t.Error("payload is not encrypted")
+			}
+
+			var out credentials
+			if err := s.Decode(&buf, &out); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if out != in {
+				t.Errorf("Decode() = %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func Test_EncryptedKeyRotation(t *testing.T) {
+	in := credentials{User: "admin", Password: "hunter2"}
+	keys := serialization.NewKeyRing("k1", testKey(1))
+
+	// Old envelopes were sealed with k1, in JSON.
+	old := &serialization.EncryptedSerializer{Format: serialization.JSON, Cipher: serialization.AESGCM, Keys: keys}
+	sealed, err := old.Marshal(&in)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	keys.Rotate("k2", testKey(2))
+	current := &serialization.EncryptedSerializer{Format: serialization.MsgPack, Cipher: serialization.ChaCha20Poly1305, Keys: keys}
+
+	var out credentials
+	if err := current.Unmarshal(sealed, &out); err != nil {
+		t.Errorf("Unmarshal() of an old envelope error = %s", err.Error())
+		return
+	}
+	if out != in {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+
+	keys.Remove("k1")
+	if err := current.Unmarshal(sealed, &out); !errors.Is(err, serialization.ErrUnknownKey) {
+		t.Errorf("Unmarshal() error = %v, want ErrUnknownKey once the old key is removed", err)
+	}
+}
+
+func Test_EncryptedTampering(t *testing.T) {
+	s := &serialization.EncryptedSerializer{
+		Format: serialization.JSON,
+		Cipher: serialization.AESGCM,
+		Keys:   serialization.NewKeyRing("k1", testKey(1)),
+	}
+
+	sealed, err := s.Marshal(&credentials{User: "admin"})
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	// The version follows the 4 bytes of the magic.
+	version := append([]byte(nil), sealed...)
+	version[4] = 0xff
+
+	sealed[len(sealed)-1] ^= 0xff
+
+	var out credentials
+	if err := s.Unmarshal(sealed, &out); err != serialization.ErrInvalidEnvelope {
+		t.Errorf("Unmarshal() error = %v, want %v", err, serialization.ErrInvalidEnvelope)
+	}
+	if err := s.Unmarshal(version, &out); !errors.Is(err, serialization.ErrInvalidEnvelope) {
+		t.Errorf("Unmarshal() of an unknown version error = %v, want %v", err, serialization.ErrInvalidEnvelope)
+	}
+}
@@ -0,0 +1,188 @@
+package serialization
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	// ErrUnknownFormat is returned when no serializer is registered for a format.
+	ErrUnknownFormat = errors.New("unknown format")
+
+	// ErrUnsupportedType is matched by errors reporting a Go type a format cannot represent.
+	ErrUnsupportedType = errors.New("unsupported type")
+)
+
+func unknownFormat(format Format) error {
+	return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// UnsupportedTypeError reports a Go type a format cannot represent,
+// or a decoding target that is not a non-nil pointer.
+// It matches ErrUnsupportedType with errors.Is.
+type UnsupportedTypeError struct {
+	Type   reflect.Type
+	Reason string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	msg := "unsupported type"
+	if e.Type != nil {
+		msg += " " + e.Type.String()
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Is reports whether target is ErrUnsupportedType.
+func (e *UnsupportedTypeError) Is(target error) bool {
+	return target == ErrUnsupportedType
+}
+
+// DecodeError reports a payload that could not be decoded.
+// Serializers return every decoding error as a DecodeError, except for
+// io.EOF on an empty stream and the FieldError, LimitError and
+// UnsupportedTypeError types, which carry their own details.
+type DecodeError struct {
+	Format Format
+
+	// Offset is the byte offset of the error in the payload, -1 when unknown.
+	Offset int64
+
+	// Path locates the offending value (e.g. "backends[0].host"), empty when unknown.
+	Path string
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	msg := e.Err.Error()
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Offset >= 0 {
+		msg = fmt.Sprintf("%s (offset %d)", msg, e.Offset)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError wraps an error returned when decoding into a DecodeError,
+// taking the offset and path from the error types of the underlying
+// libraries when available, or from the given offset (-1 when unknown).
+// Errors already typed by this package are returned unchanged, a DecodeError
+// only gaining the offset if it had none.
+func decodeError(format Format, err error, offset int64) error {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		if decodeErr.Offset < 0 {
+			decodeErr.Offset = offset
+		}
+		return err
+	}
+	if err == nil || err == io.EOF || isTyped(err) {
+		return err
+	}
+
+	e := &DecodeError{Format: format, Offset: offset, Err: err}
+	switch x := err.(type) {
+	case *json.SyntaxError:
+		e.Offset = x.Offset
+	case *json.UnmarshalTypeError:
+		e.Offset, e.Path = x.Offset, x.Field
+	case *json.InvalidUnmarshalError:
+		return &UnsupportedTypeError{Type: x.Type, Reason: "outStruct must be a non-nil pointer"}
+	case *cbor.UnmarshalTypeError:
+		e.Path = x.StructFieldName
+	case *cbor.InvalidUnmarshalError:
+		return &UnsupportedTypeError{Reason: x.Error()}
+	}
+	return e
+}
+
+// unsupportedTypeMessages are the prefixes of the errors gob and go-toml,
+// which have no error type for it, return for values they cannot represent.
+var unsupportedTypeMessages = []string{
+	"gob: type not registered for interface",
+	"gob NewTypeObject can't handle type",
+	"Marshal can't handle",
+	"Only a struct or map can be marshaled to TOML",
+}
+
+// encodeError wraps the unsupported type errors of the underlying libraries
+// into an UnsupportedTypeError. Other errors are returned unchanged.
+func encodeError(err error) error {
+	switch x := err.(type) {
+	case nil:
+		return nil
+	case *json.UnsupportedTypeError:
+		return &UnsupportedTypeError{Type: x.Type}
+	case *cbor.UnsupportedTypeError:
+		return &UnsupportedTypeError{Type: x.Type}
+	case *xml.UnsupportedTypeError:
+		return &UnsupportedTypeError{Type: x.Type}
+	}
+
+	for _, prefix := range unsupportedTypeMessages {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return &UnsupportedTypeError{Reason: err.Error()}
+		}
+	}
+	return err
+}
+
+// isTyped returns whether err already holds one of the error types of this package.
+func isTyped(err error) bool {
+	var (
+		decodeErr *DecodeError
+		fieldErr  *FieldError
+		limitErr  *LimitError
+	)
+	return errors.As(err, &decodeErr) || errors.As(err, &fieldErr) || errors.As(err, &limitErr) ||
+		errors.Is(err, ErrUnsupportedType)
+}
+
+// withPath prepends a path element, a field name or an "[index]", to the
+// path of a decode error. FieldError and LimitError get the element added to
+// their own path, UnsupportedTypeError is returned unchanged, and other
+// errors are wrapped in a DecodeError.
+func withPath(format Format, err error, elem string) error {
+	var (
+		decodeErr *DecodeError
+		fieldErr  *FieldError
+		limitErr  *LimitError
+	)
+	switch {
+	case errors.As(err, &decodeErr):
+		decodeErr.Path = prependPath(elem, decodeErr.Path)
+	case errors.As(err, &fieldErr):
+		fieldErr.Path = prependPath(elem, fieldErr.Path)
+	case errors.As(err, &limitErr):
+		limitErr.Path = prependPath(elem, limitErr.Path)
+	case errors.Is(err, ErrUnsupportedType):
+	default:
+		return &DecodeError{Format: format, Offset: -1, Path: elem, Err: err}
+	}
+	return err
+}
+
+// prependPath prepends a path element to path.
+func prependPath(elem, path string) string {
+	if strings.HasPrefix(path, "[") {
+		return elem + path
+	}
+	return joinPath(elem, path)
+}
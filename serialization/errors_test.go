@@ -0,0 +1,221 @@
+package serialization_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type errorsBackend struct {
+	Host string `json:"host" msg:"host" yaml:"host" cbor:"host" toml:"host"`
+	Port int    `json:"port" msg:"port" yaml:"port" cbor:"port" toml:"port"`
+}
+
+type errorsConfig struct {
+	Name     string          `json:"name" msg:"name" yaml:"name" cbor:"name" toml:"name"`
+	Backends []errorsBackend `json:"backends" msg:"backends" yaml:"backends" cbor:"backends" toml:"backends"`
+}
+
+func Test_ErrUnknownFormat(t *testing.T) {
+	_, err := serialization.Marshal(errorsConfig{}, "application/unknown")
+	if !errors.Is(err, serialization.ErrUnknownFormat) {
+		t.Errorf("Marshal() error = %v, want ErrUnknownFormat", err)
+		return
+	}
+	if err.Error() != "unknown format: application/unknown" {
+		t.Errorf("Marshal() error = %s", err.Error())
+	}
+
+	if err := serialization.Unmarshal([]byte("{}"), &errorsConfig{}, "application/unknown"); !errors.Is(err, serialization.ErrUnknownFormat) {
+		t.Errorf("Unmarshal() error = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := serialization.NewStreamDecoder(nil, "application/unknown"); !errors.Is(err, serialization.ErrUnknownFormat) {
+		t.Errorf("NewStreamDecoder() error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func Test_ErrUnsupportedType(t *testing.T) {
+	for _, format := range serialization.Formats() {
+		t.Run(string(format), func(t *testing.T) {
+			for _, in := range []interface{}{make(chan int), map[string]interface{}{"c": make(chan int)}} {
+				_, err := serialization.Marshal(in, format)
+				if !errors.Is(err, serialization.ErrUnsupportedType) {
+					t.Errorf("Marshal(%T) error = %v, want ErrUnsupportedType", in, err)
+				}
+			}
+		})
+	}
+
+	enc, _ := serialization.NewStreamEncoder(&strings.Builder{}, serialization.YAML)
+	if err := enc.Encode(make(chan int)); !errors.Is(err, serialization.ErrUnsupportedType) {
+		t.Errorf("Encode() error = %v, want ErrUnsupportedType", err)
+	}
+
+	for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.CBOR, serialization.CSV} {
+		t.Run(string(format)+"/target", func(t *testing.T) {
+			data, err := serialization.Marshal([]errorsBackend{{Host: "a"}}, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out []errorsBackend
+			err = serialization.Unmarshal(data, out, format)
+			var typeErr *serialization.UnsupportedTypeError
+			if !errors.As(err, &typeErr) || !errors.Is(err, serialization.ErrUnsupportedType) {
+				t.Errorf("Unmarshal() error = %v, want UnsupportedTypeError", err)
+			}
+		})
+	}
+}
+
+func Test_DecodeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   serialization.Format
+		data     string
+		wantPath string // suffix, encoding/json paths vary between Go versions
+	}{
+		{"json syntax", serialization.JSON, `{"name": }`, ""},
+		{"json type", serialization.JSON, `{"backends": [{"port": 1}, {"port": "x"}]}`, "port"},
+		{"yaml", serialization.YAML, "name: [", ""},
+		{"cbor", serialization.CBOR, "\xa1\x64name", ""},
+		{"toml", serialization.TOML, "name = ", ""},
+		{"xml", serialization.XML, "<doc><name></doc>", ""},
+		{"gob", serialization.Gob, "\x01\x02\x03", ""},
+		{"csv", serialization.CSV, "host,port\na,x\n", "[0].port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out interface{} = &errorsConfig{}
+			if tt.format == serialization.CSV {
+				out = &[]errorsBackend{}
+			}
+
+			err := serialization.Unmarshal([]byte(tt.data), out, tt.format)
+			var decodeErr *serialization.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Errorf("Unmarshal() error = %v, want DecodeError", err)
+				return
+			}
+			if decodeErr.Format != tt.format {
+				t.Errorf("Format = %s, want %s", decodeErr.Format, tt.format)
+			}
+			if !strings.HasSuffix(decodeErr.Path, tt.wantPath) {
+				t.Errorf("Path = %q, want a path ending with %q", decodeErr.Path, tt.wantPath)
+			}
+			if errors.Is(err, serialization.ErrUnsupportedType) {
+				t.Errorf("Unmarshal() error = %v, should not match ErrUnsupportedType", err)
+			}
+		})
+	}
+}
+
+func Test_DecodeError_Msgpack(t *testing.T) {
+	data, err := serialization.Marshal(map[string]interface{}{
+		"name":     "x",
+		"backends": []interface{}{map[string]interface{}{"port": 1}, map[string]interface{}{"port": "x"}},
+	}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	err = serialization.Unmarshal(data, &errorsConfig{}, serialization.MsgPack)
+	var decodeErr *serialization.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Unmarshal() error = %v, want DecodeError", err)
+		return
+	}
+	if decodeErr.Path != "backends[1].port" {
+		t.Errorf("Path = %q, want backends[1].port", decodeErr.Path)
+	}
+	if decodeErr.Offset <= 0 || decodeErr.Offset >= int64(len(data)) || data[decodeErr.Offset] != 0xa1 {
+		t.Errorf("Offset = %d, want the offset of the \"x\" string", decodeErr.Offset)
+	}
+}
+
+func Test_DecodeError_Offset(t *testing.T) {
+	err := serialization.Unmarshal([]byte(`{"name": "a", "backends": [}`), &errorsConfig{}, serialization.JSON)
+	var decodeErr *serialization.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Unmarshal() error = %v, want DecodeError", err)
+		return
+	}
+	if decodeErr.Offset != 28 {
+		t.Errorf("Offset = %d, want 28", decodeErr.Offset)
+	}
+}
+
+func Test_DecodeError_KeepsTypedErrors(t *testing.T) {
+	s := &serialization.JSONSerializer{DecodeOptions: serialization.StrictDecoding}
+	err := s.Unmarshal([]byte(`{"name": "a", "extra": 1}`), &errorsConfig{})
+	if _, ok := err.(*serialization.FieldError); !ok {
+		t.Errorf("Unmarshal() error = %v, want FieldError", err)
+	}
+}
+
+func Test_DecodeError_NestedTypedErrors(t *testing.T) {
+	type item struct {
+		C chan int `msg:"c"`
+	}
+	type doc struct {
+		Items []item `msg:"items"`
+	}
+
+	data, err := serialization.Marshal(map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"c": 1}},
+	}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	err = serialization.Unmarshal(data, &doc{}, serialization.MsgPack)
+	var decodeErr *serialization.DecodeError
+	if _, ok := err.(*serialization.UnsupportedTypeError); !ok || errors.As(err, &decodeErr) {
+		t.Errorf("Unmarshal() error = %#v, want an unwrapped UnsupportedTypeError", err)
+	}
+}
+
+func Test_DecodeError_YAMLChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		opts serialization.DecodeOptions
+		data string
+	}{
+		{"strict syntax", serialization.StrictDecoding, "name: ["},
+		{"strict alias", serialization.StrictDecoding, "a: &x [*x]\n"},
+		{"limits syntax", serialization.DecodeOptions{MaxDepth: 8}, "name: ["},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := serialization.UnmarshalWithOptions([]byte(tt.data), &errorsConfig{}, serialization.YAML, tt.opts)
+			var decodeErr *serialization.DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Format != serialization.YAML {
+				t.Errorf("UnmarshalWithOptions() error = %v, want DecodeError", err)
+			}
+		})
+	}
+
+}
+
+func Test_DecodeError_Generic(t *testing.T) {
+	tests := map[serialization.Format]string{
+		serialization.JSON:    `{"name": }`,
+		serialization.YAML:    "name: [",
+		serialization.MsgPack: "\x81\xa4name\xc1",
+	}
+	for format, data := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			_, err := serialization.DecodeGeneric(strings.NewReader(data), format)
+			var decodeErr *serialization.DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Format != format {
+				t.Errorf("DecodeGeneric() error = %v, want DecodeError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package serialization
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/purposed/good/internal/structs"
+)
+
+// structField describes a serializable struct field.
+type structField = structs.Field
+
+// fieldCacheKey identifies the fields of a type for a list of tag names.
+// The remaining names are joined, so lookups with up to two names don't allocate.
+type fieldCacheKey struct {
+	typ       reflect.Type
+	tag       string
+	otherTags string
+}
+
+var fieldCache sync.Map
+
+// cachedFields returns the serializable fields of a struct type, honouring the
+// first tag found among tagNames. Untagged embedded structs are flattened.
+func cachedFields(t reflect.Type, tagNames ...string) []structField {
+	key := fieldCacheKey{typ: t}
+	if len(tagNames) > 0 {
+		key.tag, key.otherTags = tagNames[0], strings.Join(tagNames[1:], ",")
+	}
+	if fields, ok := fieldCache.Load(key); ok {
+		return fields.([]structField)
+	}
+
+	fields := structs.Fields(t, tagNames)
+	fieldCache.Store(key, fields)
+	return fields
+}
+
+// lookupField finds a field by name, falling back to a case-insensitive match
+// when fold is set.
+func lookupField(fields []structField, name string, fold bool) (structField, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	if !fold {
+		return structField{}, false
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldByIndex returns the field at index, skipping nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc returns the field at index, allocating nil embedded pointers.
+// As in encoding/json, it fails on nil pointers to unexported embedded structs,
+// which cannot be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct: %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
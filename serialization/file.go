@@ -0,0 +1,180 @@
+package serialization
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultFileMode is the mode of files created by SaveFile.
+const DefaultFileMode os.FileMode = 0644
+
+// SaveOptions configures SaveFileWithOptions.
+type SaveOptions struct {
+	// Format overrides the format detected from the file extension.
+	Format Format
+
+	// Mode is used when creating the file. Existing files keep their mode.
+	// Defaults to DefaultFileMode.
+	Mode os.FileMode
+
+	// Backups is the number of previous versions to keep, as name.1 (newest) to name.N.
+	Backups int
+}
+
+// LoadFile decodes a file into the struct, picking the format from the
+// file extension and sniffing its contents otherwise.
+func LoadFile(name string, outStruct interface{}) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	format, err := DetectFile(name, data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return Unmarshal(data, outStruct, format)
+}
+
+// SaveFile atomically writes the struct to a file in the format matching its extension.
+func SaveFile(name string, inStruct interface{}) error {
+	return SaveFileWithOptions(name, inStruct, SaveOptions{})
+}
+
+// SaveFileWithOptions atomically writes the struct to a file.
+//
+// The struct is encoded to a temporary file in the same directory, which is
+// synced to disk and renamed over the target, so readers only ever observe
+// the previous or the new contents.
+func SaveFileWithOptions(name string, inStruct interface{}, opts SaveOptions) error {
+	format := opts.Format
+	if format == "" {
+		detected, ok := DetectName(name)
+		if !ok {
+			return fmt.Errorf("%s: unable to detect format from extension", name)
+		}
+		format = detected
+	}
+
+	serializer, ok := Lookup(format)
+	if !ok {
+		return unknownFormat(format)
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = DefaultFileMode
+	}
+	exists := false
+	if info, err := os.Stat(name); err == nil {
+		mode, exists = info.Mode().Perm(), true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if err := writeFile(tmp, serializer, inStruct, mode); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if exists && opts.Backups > 0 {
+		if err := rotateBackups(name, opts.Backups); err != nil {
+			os.Remove(tmpName)
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+func writeFile(f *os.File, serializer FormatSerializer, inStruct interface{}, mode os.FileMode) error {
+	w := bufio.NewWriter(f)
+	if err := serializer.Encode(inStruct, w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// rotateBackups shifts name.1 ... name.(n-1) up by one and links the current
+// file as name.1, leaving name itself in place until it is replaced.
+func rotateBackups(name string, n int) error {
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", name, i) }
+
+	if err := os.Remove(backup(n)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := n - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Link(name, backup(1)); err == nil {
+		return nil
+	}
+	return copyFile(name, backup(1))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir persists the directory entry of a rename. Not every platform
+// supports syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
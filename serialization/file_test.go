@@ -0,0 +1,128 @@
+package serialization_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type fileConfig struct {
+	Name  string `json:"name" yaml:"name" msg:"name"`
+	Count int    `json:"count" yaml:"count" msg:"count"`
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "serialization")
+	if err != nil {
+		t.Fatalf("TempDir() error = %s", err.Error())
+	}
+	return dir
+}
+
+func Test_SaveLoadFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"config.json", "config.yaml", "config.msgpack"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			in := fileConfig{Name: "hello", Count: 3}
+
+			if err := serialization.SaveFile(path, in); err != nil {
+				t.Errorf("SaveFile() error = %s", err.Error())
+				return
+			}
+
+			var out fileConfig
+			if err := serialization.LoadFile(path, &out); err != nil {
+				t.Errorf("LoadFile() error = %s", err.Error())
+				return
+			}
+			if out != in {
+				t.Errorf("LoadFile() = %v, want %v", out, in)
+			}
+		})
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Errorf("ReadDir() error = %s", err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func Test_SaveFile_PreservesMode(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	if err := serialization.SaveFileWithOptions(path, fileConfig{}, serialization.SaveOptions{Mode: 0600}); err != nil {
+		t.Errorf("SaveFileWithOptions() error = %s", err.Error())
+		return
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Errorf("Chmod() error = %s", err.Error())
+		return
+	}
+	if err := serialization.SaveFile(path, fileConfig{Count: 1}); err != nil {
+		t.Errorf("SaveFile() error = %s", err.Error())
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Errorf("Stat() error = %s", err.Error())
+		return
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %s, want %s", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func Test_SaveFile_Backups(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	opts := serialization.SaveOptions{Backups: 2}
+	for i := 0; i < 4; i++ {
+		if err := serialization.SaveFileWithOptions(path, fileConfig{Count: i}, opts); err != nil {
+			t.Errorf("SaveFileWithOptions() error = %s", err.Error())
+			return
+		}
+	}
+
+	expected := map[string]int{path: 3, path + ".1": 2, path + ".2": 1}
+	for name, count := range expected {
+		var out fileConfig
+		if err := serialization.LoadFile(name, &out); err != nil {
+			t.Errorf("LoadFile(%s) error = %s", name, err.Error())
+			continue
+		}
+		if out.Count != count {
+			t.Errorf("LoadFile(%s).Count = %d, want %d", name, out.Count, count)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups")
+	}
+}
+
+func Test_SaveFile_UnknownExtension(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if err := serialization.SaveFile(filepath.Join(dir, "config.unknown"), fileConfig{}); err == nil {
+		t.Errorf("SaveFile() expected error")
+	}
+}
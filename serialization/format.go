@@ -10,6 +10,12 @@ const (
 	MsgPack Format = "application/msgpack"
 	JSON    Format = "application/json"
 	YAML    Format = "text/x-yaml"
+	CBOR    Format = "application/cbor"
+	TOML    Format = "application/toml"
+	XML     Format = "application/xml"
+	Gob     Format = "application/x-gob"
+	CSV     Format = "text/csv"
+	TSV     Format = "text/tab-separated-values"
 )
 
 // FormatSerializer defines the method set for a format to be used by the smart serializer.
@@ -0,0 +1,317 @@
+package serialization_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/serialization"
+)
+
+type formatsNested struct {
+	Host string `json:"host" toml:"host" xml:"host"`
+	Port int    `json:"port" toml:"port" xml:"port"`
+}
+
+type formatsDoc struct {
+	XMLName xml.Name        `json:"-" toml:"-" cbor:"-" xml:"doc"`
+	Name    string          `json:"name" toml:"name" xml:"name"`
+	Count   int64           `json:"count" toml:"count" xml:"count"`
+	Ratio   float64         `json:"ratio" toml:"ratio" xml:"ratio"`
+	Enabled bool            `json:"enabled" toml:"enabled" xml:"enabled"`
+	Tags    []string        `json:"tags" toml:"tags" xml:"tags>tag"`
+	Created time.Time       `json:"created" toml:"created" xml:"created"`
+	Nested  formatsNested   `json:"nested" toml:"nested" xml:"nested"`
+	Items   []formatsNested `json:"items" toml:"items" xml:"item"`
+}
+
+func newFormatsDoc() formatsDoc {
+	return formatsDoc{
+		XMLName: xml.Name{Local: "doc"},
+		Name:    "hello",
+		Count:   -42,
+		Ratio:   0.25,
+		Enabled: true,
+		Tags:    []string{"a", "b"},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC),
+		Nested:  formatsNested{Host: "localhost", Port: 8080},
+		Items:   []formatsNested{{Host: "a", Port: 1}, {Host: "b", Port: 2}},
+	}
+}
+
+var extraFormats = []serialization.Format{
+	serialization.CBOR,
+	serialization.TOML,
+	serialization.XML,
+	serialization.Gob,
+}
+
+func checkFormatsDoc(t *testing.T, method string, format serialization.Format, in, out formatsDoc) {
+	if format == serialization.TOML {
+		// toml times are written with second precision.
+		in.Created = in.Created.Truncate(time.Second)
+	}
+	if !out.Created.Equal(in.Created) {
+		t.Errorf("%s() created = %s, want %s", method, out.Created, in.Created)
+	}
+	out.Created = in.Created
+	if out.XMLName.Local == "" {
+		// Only xml fills the XMLName field.
+		out.XMLName = in.XMLName
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("%s() = %+v, want %+v", method, out, in)
+	}
+}
+
+func Test_ExtraFormats_MarshalUnmarshal(t *testing.T) {
+	for _, format := range extraFormats {
+		t.Run(string(format), func(t *testing.T) {
+			in := newFormatsDoc()
+
+			data, err := serialization.Marshal(in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out formatsDoc
+			if err := serialization.Unmarshal(data, &out, format); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				return
+			}
+			checkFormatsDoc(t, "Unmarshal", format, in, out)
+		})
+	}
+}
+
+func Test_ExtraFormats_EncodeDecode(t *testing.T) {
+	for _, format := range extraFormats {
+		t.Run(string(format), func(t *testing.T) {
+			in := newFormatsDoc()
+
+			var buf bytes.Buffer
+			if err := serialization.Encode(in, &buf, format); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+
+			var out formatsDoc
+			if err := serialization.Decode(&buf, &out, format); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			checkFormatsDoc(t, "Decode", format, in, out)
+		})
+	}
+}
+
+func Test_ExtraFormats_Registry(t *testing.T) {
+	tests := map[string]serialization.Format{
+		"device.cbor":  serialization.CBOR,
+		"config.toml":  serialization.TOML,
+		"partner.xml":  serialization.XML,
+		"cache.gob":    serialization.Gob,
+		"text/xml":     serialization.XML,
+		"config.json":  serialization.JSON,
+		"partner.XML":  serialization.XML,
+		"unknown.blob": "",
+	}
+
+	for name, want := range tests {
+		var (
+			got serialization.Format
+			ok  bool
+		)
+		if strings.Contains(name, "/") {
+			got, ok = serialization.Resolve(serialization.Format(name))
+		} else {
+			got, ok = serialization.DetectName(name)
+		}
+		if got != want || ok != (want != "") {
+			t.Errorf("%s: got %s, %v, want %s", name, got, ok, want)
+		}
+	}
+}
+
+func Test_ExtraFormats_Options(t *testing.T) {
+	in := newFormatsDoc()
+
+	data, err := serialization.MarshalWithOptions(in, serialization.XML, serialization.EncodeOptions{Indent: "  "})
+	if err != nil {
+		t.Errorf("MarshalWithOptions() error = %s", err.Error())
+		return
+	}
+	if !strings.Contains(string(data), "\n  <name>hello</name>") {
+		t.Errorf("MarshalWithOptions() = %s, expected indented xml", data)
+	}
+
+	m := map[string]int{"b": 1, "a": 2, "c": 3}
+	first, err := serialization.MarshalWithOptions(m, serialization.CBOR, serialization.EncodeOptions{SortMapKeys: true})
+	if err != nil {
+		t.Errorf("MarshalWithOptions() error = %s", err.Error())
+		return
+	}
+	for i := 0; i < 10; i++ {
+		again, err := serialization.MarshalWithOptions(m, serialization.CBOR, serialization.EncodeOptions{SortMapKeys: true})
+		if err != nil {
+			t.Errorf("MarshalWithOptions() error = %s", err.Error())
+			return
+		}
+		if !bytes.Equal(first, again) {
+			t.Errorf("MarshalWithOptions() is not deterministic")
+			return
+		}
+	}
+}
+
+func Test_ExtraFormats_StrictDecoding(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.CBOR, serialization.TOML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(map[string]interface{}{"name": "a", "nmae": "b"}, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out formatsDoc
+			err = serialization.UnmarshalWithOptions(data, &out, format, serialization.StrictDecoding)
+			fieldErr, ok := err.(*serialization.FieldError)
+			if !ok || fieldErr.Path != "nmae" {
+				t.Errorf("UnmarshalWithOptions() error = %v, want unknown field nmae", err)
+			}
+		})
+	}
+}
+
+func Test_ExtraFormats_TrailingData(t *testing.T) {
+	opts := serialization.DecodeOptions{DisallowTrailingData: true}
+	formats := []serialization.Format{
+		serialization.CBOR,
+		serialization.TOML,
+		serialization.XML,
+		serialization.Gob,
+		serialization.Compressed(serialization.CBOR, "gzip"),
+	}
+
+	for _, format := range formats {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(newFormatsDoc(), format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out formatsDoc
+			if err := serialization.UnmarshalWithOptions(data, &out, format, opts); err != nil {
+				t.Errorf("UnmarshalWithOptions() error = %s", err.Error())
+				return
+			}
+			if format == serialization.TOML {
+				// Documents are a single table, there is no trailing data.
+				return
+			}
+
+			doubled := append(append([]byte(nil), data...), data...)
+			if format == serialization.Compressed(serialization.CBOR, "gzip") {
+				// Data trailing in the compressed payload.
+				plain, _ := serialization.Marshal(newFormatsDoc(), serialization.CBOR)
+				var buf bytes.Buffer
+				writer := gzip.NewWriter(&buf)
+				writer.Write(append(plain, plain...))
+				writer.Close()
+				doubled = buf.Bytes()
+			}
+			if err := serialization.UnmarshalWithOptions(doubled, &out, format, opts); err == nil {
+				t.Errorf("UnmarshalWithOptions() with trailing data expected an error")
+			}
+		})
+	}
+}
+
+func Test_ExtraFormats_Detect(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.CBOR, serialization.TOML, serialization.XML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(newFormatsDoc(), format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			detected, err := serialization.Detect(data)
+			if err != nil {
+				t.Errorf("Detect() error = %s", err.Error())
+				return
+			}
+			if detected != format {
+				t.Errorf("Detect() = %s, want %s", detected, format)
+			}
+		})
+	}
+}
+
+func Test_ExtraFormats_TypedOnlyOptions(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.Gob, serialization.XML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(newFormatsDoc(), format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out formatsDoc
+			opts := serialization.DecodeOptions{MaxBytes: 1 << 20, DisallowTrailingData: true}
+			if err := serialization.UnmarshalWithOptions(data, &out, format, opts); err != nil {
+				t.Errorf("UnmarshalWithOptions() error = %s", err.Error())
+				return
+			}
+			if out.Name != "hello" {
+				t.Errorf("UnmarshalWithOptions() = %+v", out)
+			}
+
+			// Field checks need a generic representation.
+			opts = serialization.DecodeOptions{DisallowUnknownFields: true}
+			err = serialization.UnmarshalWithOptions(data, &out, format, opts)
+			if !errors.Is(err, serialization.ErrUnsupportedType) {
+				t.Errorf("UnmarshalWithOptions() error = %v, want ErrUnsupportedType", err)
+			}
+		})
+	}
+}
+
+func Test_XMLDecodeOptions(t *testing.T) {
+	data, err := serialization.Marshal(newFormatsDoc(), serialization.XML)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	tests := []struct {
+		name  string
+		opts  serialization.DecodeOptions
+		limit serialization.Limit
+	}{
+		{"depth", serialization.DecodeOptions{MaxDepth: 2}, serialization.LimitDepth},
+		{"length", serialization.DecodeOptions{MaxCollectionLength: 2}, serialization.LimitCollectionLength},
+		{"string", serialization.DecodeOptions{MaxStringLength: 3}, serialization.LimitStringLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &serialization.XMLSerializer{DecodeOptions: tt.opts}
+
+			var out formatsDoc
+			limitErr, ok := s.Unmarshal(data, &out).(*serialization.LimitError)
+			if !ok || limitErr.Limit != tt.limit {
+				t.Errorf("Unmarshal() error = %v, want a %s limit error", limitErr, tt.limit)
+			}
+			if err := s.Decode(bytes.NewReader(data), &out); err == nil {
+				t.Errorf("Decode() expected an error")
+			}
+		})
+	}
+}
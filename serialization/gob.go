@@ -0,0 +1,37 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// GobSerializer serializes messages with encoding/gob, for exchanges between Go programs.
+// Each message carries its own type information. Concrete types stored in
+// interface fields must be registered with gob.Register.
+type GobSerializer struct{}
+
+// Marshal marshals inStruct to gob.
+func (m *GobSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return marshalPooled(func(w io.Writer) error {
+		return m.Encode(inStruct, w)
+	})
+}
+
+// Unmarshal unmarshals a raw gob message to a struct.
+func (m *GobSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	return m.Decode(bytes.NewReader(rawBytes), outStruct)
+}
+
+// Encode marshals the struct to a stream.
+func (m *GobSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return encodeError(gob.NewEncoder(w).Encode(inStruct))
+}
+
+// Decode unmarshals the struct from a stream.
+func (m *GobSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	return decodeError(Gob, gob.NewDecoder(r).Decode(outStruct), -1)
+}
+
+// typedOnly marks gob as having no generic representation.
+func (m *GobSerializer) typedOnly() {}
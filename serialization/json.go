@@ -1,31 +1,98 @@
 package serialization
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"sync"
 )
 
 // JSONSerializer serializes messages to json.
-type JSONSerializer struct{}
+type JSONSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
+}
 
 // Marshal marshals inStruct to msgpack.
 func (m *JSONSerializer) Marshal(inStruct interface{}) ([]byte, error) {
-	return json.Marshal(inStruct)
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to json using the given options.
+func (m *JSONSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	if opts == (EncodeOptions{}) {
+		data, err := json.Marshal(inStruct)
+		return data, encodeError(err)
+	}
+	return appendJSON(nil, inStruct, opts)
+}
+
+// MarshalAppend appends the json encoding of inStruct to dst,
+// encoding with a pooled encoder.
+func (m *JSONSerializer) MarshalAppend(dst []byte, inStruct interface{}) ([]byte, error) {
+	return appendJSON(dst, inStruct, m.EncodeOptions)
+}
+
+// jsonEncoder is a json encoder writing to its own buffer, kept in jsonEncoderPool.
+type jsonEncoder struct {
+	buf     bytes.Buffer
+	encoder *json.Encoder
+}
+
+var jsonEncoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &jsonEncoder{}
+		e.encoder = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+func appendJSON(dst []byte, inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	e := jsonEncoderPool.Get().(*jsonEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledBufferSize {
+			jsonEncoderPool.Put(e)
+		}
+	}()
+
+	e.buf.Reset()
+	e.encoder.SetIndent("", opts.Indent)
+	e.encoder.SetEscapeHTML(!opts.DisableHTMLEscaping)
+	if err := e.encoder.Encode(inStruct); err != nil {
+		return dst, encodeError(err)
+	}
+
+	// The encoder terminates each value with a newline.
+	return append(dst, e.buf.Bytes()[:e.buf.Len()-1]...), nil
 }
 
 // Unmarshal unmarshals a raw msgpack message to a struct.
 func (m *JSONSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
-	return json.Unmarshal(rawBytes, outStruct)
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(JSON, err, -1)
+	}
+	return decodeError(JSON, json.Unmarshal(rawBytes, outStruct), -1)
 }
 
 // Encode marshals the struct to a stream.
 func (m *JSONSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+func (m *JSONSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
 	encoder := json.NewEncoder(w)
-	return encoder.Encode(inStruct)
+	encoder.SetIndent("", opts.Indent)
+	encoder.SetEscapeHTML(!opts.DisableHTMLEscaping)
+	return encodeError(encoder.Encode(inStruct))
 }
 
 // Decode unmarshals the struct from a stream.
 func (m *JSONSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+
 	decoder := json.NewDecoder(r)
-	return decoder.Decode(outStruct)
+	return decodeError(JSON, decoder.Decode(outStruct), -1)
 }
@@ -0,0 +1,475 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// Limit names a decode limit.
+type Limit string
+
+// Decode limits, configured in DecodeOptions.
+const (
+	LimitBytes            Limit = "size"
+	LimitDepth            Limit = "nesting depth"
+	LimitCollectionLength Limit = "collection length"
+	LimitStringLength     Limit = "string length"
+)
+
+// LimitError is returned when a document exceeds one of the limits set in DecodeOptions.
+type LimitError struct {
+	Limit Limit
+	Max   int64
+	Path  string
+}
+
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+	if e.Path == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Path, msg)
+}
+
+// limits holds the structural limits of DecodeOptions. Zero disables a limit.
+type limits struct {
+	maxDepth  int
+	maxLength int
+	maxString int
+}
+
+func (o DecodeOptions) limits() limits {
+	return limits{
+		maxDepth:  o.MaxDepth,
+		maxLength: o.MaxCollectionLength,
+		maxString: o.MaxStringLength,
+	}
+}
+
+func (l limits) enabled() bool {
+	return l != limits{}
+}
+
+func (l limits) checkDepth(depth int, path string) error {
+	if l.maxDepth > 0 && depth > l.maxDepth {
+		return &LimitError{Limit: LimitDepth, Max: int64(l.maxDepth), Path: path}
+	}
+	return nil
+}
+
+func (l limits) checkLength(length int, path string) error {
+	if l.maxLength > 0 && length > l.maxLength {
+		return &LimitError{Limit: LimitCollectionLength, Max: int64(l.maxLength), Path: path}
+	}
+	return nil
+}
+
+func (l limits) checkString(length int, path string) error {
+	if l.maxString > 0 && length > l.maxString {
+		return &LimitError{Limit: LimitStringLength, Max: int64(l.maxString), Path: path}
+	}
+	return nil
+}
+
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// readDocument reads a whole stream, failing once it exceeds opts.MaxBytes.
+func readDocument(r io.Reader, opts DecodeOptions) ([]byte, error) {
+	if opts.MaxBytes <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, opts.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSize(data, opts); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func checkSize(data []byte, opts DecodeOptions) error {
+	if opts.MaxBytes > 0 && int64(len(data)) > opts.MaxBytes {
+		return &LimitError{Limit: LimitBytes, Max: opts.MaxBytes}
+	}
+	return nil
+}
+
+// limitChecker is implemented by serializers able to check the limits of a
+// raw document without decoding it.
+type limitChecker interface {
+	checkLimits(data []byte, opts DecodeOptions) error
+}
+
+// checkLimits ensures a raw document stays within the limits set in opts.
+// Serializers scanning their own payloads are checked before anything is
+// decoded, others through their generic representation.
+func checkLimits(s FormatSerializer, data []byte, opts DecodeOptions) error {
+	if err := checkSize(data, opts); err != nil {
+		return err
+	}
+
+	if checker, ok := s.(limitChecker); ok {
+		return checker.checkLimits(data, opts)
+	}
+
+	l := opts.limits()
+	if !l.enabled() {
+		return nil
+	}
+
+	doc, err := decodeGeneric(s, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return checkGenericLimits(doc, l, 0, "")
+}
+
+func checkGenericLimits(doc interface{}, l limits, depth int, path string) error {
+	switch x := doc.(type) {
+	case string:
+		return l.checkString(len(x), path)
+	case []byte:
+		return l.checkString(len(x), path)
+	case []interface{}:
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return err
+		}
+		if err := l.checkLength(len(x), path); err != nil {
+			return err
+		}
+		for i, item := range x {
+			if err := checkGenericLimits(item, l, depth+1, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+	case OrderedMap:
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return err
+		}
+		if err := l.checkLength(len(x), path); err != nil {
+			return err
+		}
+		for _, item := range x {
+			itemPath := joinPath(path, fmt.Sprint(item.Key))
+			if err := checkGenericLimits(item.Key, l, depth+1, itemPath); err != nil {
+				return err
+			}
+			if err := checkGenericLimits(item.Value, l, depth+1, itemPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimits scans the json tokens of a document.
+func (m *JSONSerializer) checkLimits(data []byte, opts DecodeOptions) error {
+	l := opts.limits()
+	if !l.enabled() {
+		return nil
+	}
+
+	type frame struct {
+		object    bool
+		expectKey bool
+		count     int
+		path      string
+		key       string
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var stack []*frame
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		path := ""
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			switch {
+			case top.object && top.expectKey:
+				key, _ := token.(string)
+				top.key, top.expectKey = key, false
+				top.count++
+				if err := l.checkLength(top.count, top.path); err != nil {
+					return err
+				}
+				if err := l.checkString(len(key), joinPath(top.path, key)); err != nil {
+					return err
+				}
+				continue
+			case top.object:
+				path = joinPath(top.path, top.key)
+				top.expectKey = true
+			default:
+				path = indexPath(top.path, top.count)
+				top.count++
+				if err := l.checkLength(top.count, top.path); err != nil {
+					return err
+				}
+			}
+		}
+
+		switch x := token.(type) {
+		case json.Delim:
+			if err := l.checkDepth(len(stack)+1, path); err != nil {
+				return err
+			}
+			stack = append(stack, &frame{object: x == '{', expectKey: x == '{', path: path})
+		case string:
+			if err := l.checkString(len(x), path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkLimits walks the msgpack headers of a document, without allocating
+// the collections they announce.
+func (m *MsgpackSerializer) checkLimits(data []byte, opts DecodeOptions) error {
+	l := opts.limits()
+	if !l.enabled() {
+		return nil
+	}
+
+	var err error
+	for len(data) > 0 {
+		if data, err = checkMsgpackLimits(data, l, 0, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkMsgpackLimits(b []byte, l limits, depth int, path string) ([]byte, error) {
+	switch msgp.NextType(b) {
+	case msgp.StrType:
+		s, rest, err := msgp.ReadStringZC(b)
+		if err != nil {
+			return b, err
+		}
+		return rest, l.checkString(len(s), path)
+	case msgp.BinType:
+		s, rest, err := msgp.ReadBytesZC(b)
+		if err != nil {
+			return b, err
+		}
+		return rest, l.checkString(len(s), path)
+	case msgp.ArrayType:
+		size, rest, err := msgp.ReadArrayHeaderBytes(b)
+		if err != nil {
+			return b, err
+		}
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return b, err
+		}
+		if err := l.checkLength(int(size), path); err != nil {
+			return b, err
+		}
+		for i := 0; i < int(size); i++ {
+			if rest, err = checkMsgpackLimits(rest, l, depth+1, indexPath(path, i)); err != nil {
+				return rest, err
+			}
+		}
+		return rest, nil
+	case msgp.MapType:
+		size, rest, err := msgp.ReadMapHeaderBytes(b)
+		if err != nil {
+			return b, err
+		}
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return b, err
+		}
+		if err := l.checkLength(int(size), path); err != nil {
+			return b, err
+		}
+		for i := 0; i < int(size); i++ {
+			itemPath := joinPath(path, "?")
+			if msgp.NextType(rest) == msgp.StrType {
+				if key, _, err := msgp.ReadStringZC(rest); err == nil {
+					itemPath = joinPath(path, string(key))
+				}
+			}
+			if rest, err = checkMsgpackLimits(rest, l, depth+1, itemPath); err != nil {
+				return rest, err
+			}
+			if rest, err = checkMsgpackLimits(rest, l, depth+1, itemPath); err != nil {
+				return rest, err
+			}
+		}
+		return rest, nil
+	}
+	return msgp.Skip(b)
+}
+
+// checkLimits walks the nodes of every document of a yaml stream. Aliases are
+// not followed: they are bounded by the limits of the node they refer to.
+func (m *YAMLSerializer) checkLimits(data []byte, opts DecodeOptions) error {
+	l := opts.limits()
+	if !l.enabled() {
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return decodeError(YAML, err, -1)
+		}
+		if err := checkYAMLLimits(&node, l, 0, ""); err != nil {
+			return err
+		}
+	}
+}
+
+func checkYAMLLimits(node *yaml.Node, l limits, depth int, path string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := checkYAMLLimits(child, l, depth, path); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return l.checkString(len(node.Value), path)
+	case yaml.SequenceNode:
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return err
+		}
+		if err := l.checkLength(len(node.Content), path); err != nil {
+			return err
+		}
+		for i, child := range node.Content {
+			if err := checkYAMLLimits(child, l, depth+1, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		if err := l.checkDepth(depth+1, path); err != nil {
+			return err
+		}
+		if err := l.checkLength(len(node.Content)/2, path); err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			itemPath := joinPath(path, node.Content[i].Value)
+			if err := checkYAMLLimits(node.Content[i], l, depth+1, itemPath); err != nil {
+				return err
+			}
+			if err := checkYAMLLimits(node.Content[i+1], l, depth+1, itemPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkLimits scans the xml tokens of a document. Elements are collections
+// of their attributes and of their child elements.
+func (m *XMLSerializer) checkLimits(data []byte, opts DecodeOptions) error {
+	l := opts.limits()
+	if !l.enabled() {
+		return nil
+	}
+
+	type frame struct {
+		count int
+		path  string
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var stack []*frame
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch x := token.(type) {
+		case xml.StartElement:
+			path := ""
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				path = joinPath(top.path, x.Name.Local)
+				top.count++
+				if err := l.checkLength(top.count, top.path); err != nil {
+					return err
+				}
+			}
+			if err := l.checkDepth(len(stack)+1, path); err != nil {
+				return err
+			}
+
+			for _, attr := range x.Attr {
+				if err := l.checkString(len(attr.Value), joinPath(path, attr.Name.Local)); err != nil {
+					return err
+				}
+			}
+			stack = append(stack, &frame{count: len(x.Attr), path: path})
+			if err := l.checkLength(len(x.Attr), path); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			path := ""
+			if len(stack) > 0 {
+				path = stack[len(stack)-1].path
+			}
+			if err := l.checkString(len(x), path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkLimits decompresses the document, failing once the payload exceeds
+// the size limit, and checks the limits of the uncompressed payload.
+func (m *CompressedSerializer) checkLimits(data []byte, opts DecodeOptions) error {
+	c, ok := detectCompression(data)
+	if !ok {
+		return checkLimits(m.Serializer, data, opts)
+	}
+
+	reader, err := c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if data, err = readDocument(reader, opts); err != nil {
+		return err
+	}
+	return checkLimits(m.Serializer, data, opts)
+}
@@ -0,0 +1,105 @@
+package serialization_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+func Test_DecodeLimits(t *testing.T) {
+	limited := serialization.DecodeOptions{
+		MaxBytes:            256,
+		MaxDepth:            3,
+		MaxCollectionLength: 4,
+		MaxStringLength:     8,
+	}
+
+	msgpackDoc := func(v interface{}) string {
+		data, err := serialization.Marshal(v, serialization.MsgPack)
+		if err != nil {
+			t.Fatalf("Marshal() error = %s", err.Error())
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name      string
+		format    serialization.Format
+		data      string
+		wantLimit serialization.Limit
+		wantPath  string
+	}{
+		{"json valid", serialization.JSON, `{"name": "a", "backends": [{"host": "h"}]}`, "", ""},
+		{"json size", serialization.JSON, `{"name": "` + strings.Repeat(" ", 300) + `"}`, serialization.LimitBytes, ""},
+		{"json depth", serialization.JSON, `{"backends": [{"host": {"a": 1}}]}`, serialization.LimitDepth, "backends[0].host"},
+		{"json collection", serialization.JSON, `{"backends": [{}, {}, {}, {}, {}]}`, serialization.LimitCollectionLength, "backends"},
+		{"json string", serialization.JSON, `{"name": "too long a name"}`, serialization.LimitStringLength, "name"},
+		{"json key", serialization.JSON, `{"very long key": 1}`, serialization.LimitStringLength, "very long key"},
+		{"msgpack valid", serialization.MsgPack, msgpackDoc(map[string]interface{}{"name": "a"}), "", ""},
+		{"msgpack depth", serialization.MsgPack, msgpackDoc(map[string]interface{}{"backends": []interface{}{map[string]interface{}{"host": []int{1}}}}), serialization.LimitDepth, "backends[0].host"},
+		{"msgpack collection", serialization.MsgPack, msgpackDoc(map[string]interface{}{"backends": make([]int, 5)}), serialization.LimitCollectionLength, "backends"},
+		{"msgpack string", serialization.MsgPack, msgpackDoc(map[string]interface{}{"name": "too long a name"}), serialization.LimitStringLength, "name"},
+		// An array header announcing 2^32-1 items, with no items following.
+		{"msgpack huge header", serialization.MsgPack, "\xdd\xff\xff\xff\xff", serialization.LimitCollectionLength, ""},
+		{"yaml valid", serialization.YAML, "name: a\nbackends:\n  - host: h\n", "", ""},
+		{"yaml depth", serialization.YAML, "backends:\n  - host:\n      - 1\n", serialization.LimitDepth, "backends[0].host"},
+		{"yaml collection", serialization.YAML, "backends: [1, 2, 3, 4, 5]\n", serialization.LimitCollectionLength, "backends"},
+		{"yaml string", serialization.YAML, "name: too long a name\n", serialization.LimitStringLength, "name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strictConfig
+			err := serialization.DecodeWithOptions(strings.NewReader(tt.data), &out, tt.format, limited)
+
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Errorf("DecodeWithOptions() error = %s", err.Error())
+				}
+				return
+			}
+
+			limitErr, ok := err.(*serialization.LimitError)
+			if !ok {
+				t.Errorf("DecodeWithOptions() error = %v, want LimitError", err)
+				return
+			}
+			if limitErr.Limit != tt.wantLimit || limitErr.Path != tt.wantPath {
+				t.Errorf("DecodeWithOptions() error = %s, want %s limit at %q", limitErr.Error(), tt.wantLimit, tt.wantPath)
+			}
+		})
+	}
+}
+
+func Test_DecodeLimits_Serializer(t *testing.T) {
+	s := &serialization.JSONSerializer{DecodeOptions: serialization.DecodeOptions{MaxBytes: 16}}
+
+	var out strictConfig
+	err := s.Decode(strings.NewReader(`{"name": "a long enough name"}`), &out)
+	if _, ok := err.(*serialization.LimitError); !ok {
+		t.Errorf("Decode() error = %v, want LimitError", err)
+	}
+}
+
+func Test_DecodeLimits_Compressed(t *testing.T) {
+	format := serialization.Compressed(serialization.JSON, serialization.Gzip)
+
+	var buf bytes.Buffer
+	if err := serialization.Encode(map[string]string{"name": strings.Repeat("a", 4096)}, &buf, format); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+	if buf.Len() > 1024 {
+		t.Errorf("compressed size = %d, expected a small payload", buf.Len())
+		return
+	}
+
+	var out strictConfig
+	err := serialization.DecodeWithOptions(&buf, &out, format, serialization.DecodeOptions{MaxBytes: 1024})
+	limitErr, ok := err.(*serialization.LimitError)
+	if !ok || limitErr.Limit != serialization.LimitBytes {
+		t.Errorf("DecodeWithOptions() error = %v, want size LimitError", err)
+	}
+}
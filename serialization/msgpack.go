@@ -1,52 +1,138 @@
 package serialization
 
 import (
-	"errors"
+	"bytes"
 	"io"
+	"reflect"
+	"sync"
 
 	"github.com/tinylib/msgp/msgp"
 )
 
 // MsgpackSerializer implements msgpack serialization
 // for the smart serializer.
+//
+// Types generated by msgp are serialized with their generated methods,
+// other types fall back to a reflection-based codec honouring the
+// `msg` and `json` struct tags.
 type MsgpackSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
 }
 
 // Marshal marshals inStruct to msgpack.
 func (m *MsgpackSerializer) Marshal(inStruct interface{}) ([]byte, error) {
-	mrsh, ok := inStruct.(msgp.Marshaler)
-	if !ok {
-		return nil, errors.New("in struct does not implement msgp.Marshaler")
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to msgpack using the given options.
+// Options do not apply to types implementing msgp.Marshaler.
+func (m *MsgpackSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	if sizer, ok := inStruct.(msgp.Sizer); ok {
+		if mrsh, ok := inStruct.(msgp.Marshaler); ok {
+			return mrsh.MarshalMsg(make([]byte, 0, sizer.Msgsize()))
+		}
+	}
+
+	// Encode to a pooled scratch buffer, so the result is allocated once at its final size.
+	scratch := getBytes()
+	defer putBytes(scratch)
+
+	b, err := appendMsgpack((*scratch)[:0], inStruct, opts)
+	*scratch = b
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// MarshalAppend appends the msgpack encoding of inStruct to dst.
+func (m *MsgpackSerializer) MarshalAppend(dst []byte, inStruct interface{}) ([]byte, error) {
+	b, err := appendMsgpack(dst, inStruct, m.EncodeOptions)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+func appendMsgpack(dst []byte, inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	if mrsh, ok := inStruct.(msgp.Marshaler); ok {
+		return mrsh.MarshalMsg(dst)
 	}
-	return mrsh.MarshalMsg(nil)
+	return msgpackEncoder{opts: opts}.append(dst, reflect.ValueOf(inStruct))
 }
 
 // Unmarshal unmarshals a raw msgpack message to a struct.
 func (m *MsgpackSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
-	unmarshaler, ok := outStruct.(msgp.Unmarshaler)
-	if !ok {
-		return errors.New("outStruct does not implement msgp.Unmarshaler")
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(MsgPack, err, -1)
 	}
 
-	_, err := unmarshaler.UnmarshalMsg(rawBytes)
-	return err
+	if unmarshaler, ok := outStruct.(msgp.Unmarshaler); ok {
+		rest, err := unmarshaler.UnmarshalMsg(rawBytes)
+		return decodeError(MsgPack, err, int64(len(rawBytes)-len(rest)))
+	}
+
+	outValue := reflect.ValueOf(outStruct)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return &UnsupportedTypeError{Type: reflect.TypeOf(outStruct), Reason: "outStruct must be a non-nil pointer"}
+	}
+
+	rest, err := readMsgpack(rawBytes, outValue.Elem())
+	return decodeError(MsgPack, err, int64(len(rawBytes)-len(rest)))
 }
 
 // Encode marshals the struct to a stream.
 func (m *MsgpackSerializer) Encode(inStruct interface{}, w io.Writer) error {
-	marshaler, ok := inStruct.(msgp.Encodable)
-	if !ok {
-		return errors.New("inStruct does not implement msgp.Encodable")
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+// Options do not apply to types implementing msgp.Encodable.
+func (m *MsgpackSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	if marshaler, ok := inStruct.(msgp.Encodable); ok {
+		// msgp.Encode uses a pooled writer.
+		return msgp.Encode(w, marshaler)
+	}
+
+	scratch := getBytes()
+	defer putBytes(scratch)
+
+	b, err := appendMsgpack((*scratch)[:0], inStruct, opts)
+	*scratch = b
+	if err != nil {
+		return err
 	}
-	return marshaler.EncodeMsg(msgp.NewWriter(w))
+	_, err = w.Write(b)
+	return err
 }
 
 // Decode unmarshals the struct from a stream.
 func (m *MsgpackSerializer) Decode(r io.Reader, outStruct interface{}) error {
-	decoder, ok := outStruct.(msgp.Decodable)
-	if !ok {
-		return errors.New("outStruct does not implement msgp.Decodable")
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+
+	if decoder, ok := outStruct.(msgp.Decodable); ok {
+		// msgp.Decode uses a pooled reader.
+		return decodeError(MsgPack, msgp.Decode(r, decoder), -1)
 	}
 
-	return decoder.DecodeMsg(msgp.NewReader(r))
+	reader := msgpackReaderPool.Get().(*msgp.Reader)
+	reader.Reset(r)
+	defer func() {
+		reader.Reset(nil)
+		msgpackReaderPool.Put(reader)
+	}()
+
+	// The record isn't pooled, decoded values may keep references to it.
+	var buf bytes.Buffer
+	if _, err := reader.CopyNext(&buf); err != nil {
+		return decodeError(MsgPack, err, -1)
+	}
+	return m.Unmarshal(buf.Bytes(), outStruct)
+}
+
+var msgpackReaderPool = sync.Pool{
+	New: func() interface{} { return msgp.NewReader(nil) },
 }
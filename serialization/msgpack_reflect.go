@@ -0,0 +1,450 @@
+package serialization
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+var (
+	marshalerType   = reflect.TypeOf((*msgp.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*msgp.Unmarshaler)(nil)).Elem()
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// msgpackTags are the struct tags honoured by the reflection codec, by priority.
+var msgpackTags = []string{"msg", "json"}
+
+// msgpackEncoder encodes values to msgpack using reflection.
+type msgpackEncoder struct {
+	opts EncodeOptions
+}
+
+// append appends the msgpack encoding of v to b, delegating to generated
+// code for values implementing msgp.Marshaler.
+func (e msgpackEncoder) append(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return msgp.AppendNil(b), nil
+	}
+
+	if v.Type().Implements(marshalerType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return msgp.AppendNil(b), nil
+		}
+		return v.Interface().(msgp.Marshaler).MarshalMsg(b)
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(marshalerType) {
+		return v.Addr().Interface().(msgp.Marshaler).MarshalMsg(b)
+	}
+
+	if v.Type() == timeType {
+		return e.appendTime(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return msgp.AppendNil(b), nil
+		}
+		return e.append(b, v.Elem())
+	case reflect.Bool:
+		return msgp.AppendBool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return msgp.AppendInt64(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return msgp.AppendUint64(b, v.Uint()), nil
+	case reflect.Float32:
+		return msgp.AppendFloat32(b, float32(v.Float())), nil
+	case reflect.Float64:
+		if f := v.Float(); e.opts.CompactFloats && float64(float32(f)) == f {
+			return msgp.AppendFloat32(b, float32(f)), nil
+		}
+		return msgp.AppendFloat64(b, v.Float()), nil
+	case reflect.Complex64:
+		return msgp.AppendComplex64(b, complex64(v.Complex())), nil
+	case reflect.Complex128:
+		return msgp.AppendComplex128(b, v.Complex()), nil
+	case reflect.String:
+		return msgp.AppendString(b, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return msgp.AppendNil(b), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return msgp.AppendBytes(b, v.Bytes()), nil
+		}
+		return e.appendArray(b, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			raw := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(raw), v)
+			return msgp.AppendBytes(b, raw), nil
+		}
+		return e.appendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return msgp.AppendNil(b), nil
+		}
+		return e.appendMap(b, v)
+	case reflect.Struct:
+		return e.appendStruct(b, v)
+	}
+	return b, &UnsupportedTypeError{Type: v.Type()}
+}
+
+func (e msgpackEncoder) appendArray(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+
+	b = msgp.AppendArrayHeader(b, uint32(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if b, err = e.append(b, v.Index(i)); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func (e msgpackEncoder) appendMap(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+
+	b = msgp.AppendMapHeader(b, uint32(v.Len()))
+	if !e.opts.SortMapKeys {
+		iter := v.MapRange()
+		for iter.Next() {
+			if b, err = e.append(b, iter.Key()); err != nil {
+				return b, err
+			}
+			if b, err = e.append(b, iter.Value()); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+
+	// Keys are encoded separately so entries can be sorted before being written.
+	type entry struct {
+		sortKey string
+		key     []byte
+		value   reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := e.append(nil, iter.Key())
+		if err != nil {
+			return b, err
+		}
+
+		sortKey := string(key)
+		if iter.Key().Kind() == reflect.String {
+			sortKey = iter.Key().String()
+		}
+		entries = append(entries, entry{sortKey: sortKey, key: key, value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sortKey < entries[j].sortKey })
+
+	for _, en := range entries {
+		b = append(b, en.key...)
+		if b, err = e.append(b, en.value); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func (e msgpackEncoder) appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	fields := cachedFields(v.Type(), msgpackTags...)
+
+	// Fields are walked twice, counting them before writing the header, so no slice is allocated.
+	size := 0
+	for i := range fields {
+		if _, ok := encodedField(v, &fields[i]); ok {
+			size++
+		}
+	}
+
+	var err error
+	b = msgp.AppendMapHeader(b, uint32(size))
+	for i := range fields {
+		fv, ok := encodedField(v, &fields[i])
+		if !ok {
+			continue
+		}
+		b = msgp.AppendString(b, fields[i].Name)
+		if b, err = e.append(b, fv); err != nil {
+			return b, fmt.Errorf("%s: %w", fields[i].Name, err)
+		}
+	}
+	return b, nil
+}
+
+// encodedField returns the value of a struct field, and whether it is encoded.
+func encodedField(v reflect.Value, f *structField) (reflect.Value, bool) {
+	fv, ok := fieldByIndex(v, f.Index)
+	if !ok || (f.OmitEmpty && isEmptyValue(fv)) {
+		return fv, false
+	}
+	return fv, true
+}
+
+// readMsgpack decodes the next msgpack object of b into v using reflection,
+// delegating to generated code for values implementing msgp.Unmarshaler.
+// It returns the remaining bytes.
+func readMsgpack(b []byte, v reflect.Value) ([]byte, error) {
+	if v.CanAddr() && v.Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		return v.Addr().Interface().(msgp.Unmarshaler).UnmarshalMsg(b)
+	}
+
+	if msgp.IsNil(b) {
+		if v.CanSet() {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return msgp.ReadNilBytes(b)
+	}
+
+	if v.Type() == timeType {
+		t, o, err := readMsgpackTime(b)
+		if err != nil {
+			return b, err
+		}
+		v.Set(reflect.ValueOf(t))
+		return o, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return readMsgpack(b, v.Elem())
+	case reflect.Interface:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Ptr {
+			return readMsgpack(b, v.Elem())
+		}
+		if v.NumMethod() != 0 {
+			return b, &UnsupportedTypeError{Type: v.Type(), Reason: "msgpack cannot decode into a non-empty interface"}
+		}
+		i, o, err := msgp.ReadIntfBytes(b)
+		if err != nil {
+			return b, err
+		}
+		v.Set(reflect.ValueOf(i))
+		return o, nil
+	case reflect.Bool:
+		x, o, err := msgp.ReadBoolBytes(b)
+		if err != nil {
+			return b, err
+		}
+		v.SetBool(x)
+		return o, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, o, err := msgp.ReadInt64Bytes(b)
+		if err != nil {
+			return b, err
+		}
+		if v.OverflowInt(x) {
+			return b, fmt.Errorf("msgpack: %d overflows %s", x, v.Type())
+		}
+		v.SetInt(x)
+		return o, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, o, err := msgp.ReadUint64Bytes(b)
+		if err != nil {
+			return b, err
+		}
+		if v.OverflowUint(x) {
+			return b, fmt.Errorf("msgpack: %d overflows %s", x, v.Type())
+		}
+		v.SetUint(x)
+		return o, nil
+	case reflect.Float32, reflect.Float64:
+		x, o, err := readMsgpackNumber(b)
+		if err != nil {
+			return b, err
+		}
+		v.SetFloat(x)
+		return o, nil
+	case reflect.Complex64, reflect.Complex128:
+		x, o, err := msgp.ReadComplex128Bytes(b)
+		if err != nil {
+			c64, o64, err64 := msgp.ReadComplex64Bytes(b)
+			if err64 != nil {
+				return b, err
+			}
+			x, o = complex128(c64), o64
+		}
+		v.SetComplex(x)
+		return o, nil
+	case reflect.String:
+		x, o, err := readMsgpackRawString(b)
+		if err != nil {
+			return b, err
+		}
+		v.SetString(string(x))
+		return o, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			x, o, err := readMsgpackRawString(b)
+			if err != nil {
+				return b, err
+			}
+			raw := reflect.MakeSlice(v.Type(), len(x), len(x))
+			reflect.Copy(raw, reflect.ValueOf(x))
+			v.Set(raw)
+			return o, nil
+		}
+		return readMsgpackSlice(b, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			x, o, err := readMsgpackRawString(b)
+			if err != nil {
+				return b, err
+			}
+			reflect.Copy(v, reflect.ValueOf(x))
+			return o, nil
+		}
+		return readMsgpackArray(b, v)
+	case reflect.Map:
+		return readMsgpackMap(b, v)
+	case reflect.Struct:
+		return readMsgpackStruct(b, v)
+	}
+	return b, &UnsupportedTypeError{Type: v.Type()}
+}
+
+// readMsgpackNumber reads any msgpack number as a float64.
+func readMsgpackNumber(b []byte) (float64, []byte, error) {
+	switch msgp.NextType(b) {
+	case msgp.IntType:
+		x, o, err := msgp.ReadInt64Bytes(b)
+		return float64(x), o, err
+	case msgp.UintType:
+		x, o, err := msgp.ReadUint64Bytes(b)
+		return float64(x), o, err
+	}
+	return msgp.ReadFloat64Bytes(b)
+}
+
+// checkMsgpackLength rejects a collection header announcing more items than
+// the remaining bytes can hold, each item taking at least itemSize bytes,
+// before anything is allocated from it.
+func checkMsgpackLength(sz uint32, itemSize int, remaining []byte) error {
+	if uint64(sz)*uint64(itemSize) > uint64(len(remaining)) {
+		return msgp.ErrShortBytes
+	}
+	return nil
+}
+
+// readMsgpackRawString reads either a str or a bin object without copying.
+func readMsgpackRawString(b []byte) ([]byte, []byte, error) {
+	if msgp.NextType(b) == msgp.BinType {
+		return msgp.ReadBytesZC(b)
+	}
+	return msgp.ReadStringZC(b)
+}
+
+func readMsgpackSlice(b []byte, v reflect.Value) ([]byte, error) {
+	sz, o, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if err := checkMsgpackLength(sz, 1, o); err != nil {
+		return b, err
+	}
+
+	slice := reflect.MakeSlice(v.Type(), int(sz), int(sz))
+	for i := 0; i < int(sz); i++ {
+		if o, err = readMsgpack(o, slice.Index(i)); err != nil {
+			return o, withPath(MsgPack, err, fmt.Sprintf("[%d]", i))
+		}
+	}
+	v.Set(slice)
+	return o, nil
+}
+
+func readMsgpackArray(b []byte, v reflect.Value) ([]byte, error) {
+	sz, o, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+
+	for i := 0; i < int(sz); i++ {
+		if i >= v.Len() {
+			if o, err = msgp.Skip(o); err != nil {
+				return o, err
+			}
+			continue
+		}
+		if o, err = readMsgpack(o, v.Index(i)); err != nil {
+			return o, withPath(MsgPack, err, fmt.Sprintf("[%d]", i))
+		}
+	}
+	for i := int(sz); i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return o, nil
+}
+
+func readMsgpackMap(b []byte, v reflect.Value) ([]byte, error) {
+	sz, o, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if err := checkMsgpackLength(sz, 2, o); err != nil {
+		return b, err
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), int(sz)))
+	}
+
+	keyType, elemType := v.Type().Key(), v.Type().Elem()
+	for i := 0; i < int(sz); i++ {
+		key := reflect.New(keyType).Elem()
+		if o, err = readMsgpack(o, key); err != nil {
+			return o, err
+		}
+
+		elem := reflect.New(elemType).Elem()
+		if o, err = readMsgpack(o, elem); err != nil {
+			return o, withPath(MsgPack, err, fmt.Sprint(key.Interface()))
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return o, nil
+}
+
+func readMsgpackStruct(b []byte, v reflect.Value) ([]byte, error) {
+	sz, o, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+
+	fields := cachedFields(v.Type(), msgpackTags...)
+	for i := 0; i < int(sz); i++ {
+		var key []byte
+		if key, o, err = msgp.ReadMapKeyZC(o); err != nil {
+			return o, err
+		}
+
+		f, ok := lookupField(fields, string(key), true)
+		if !ok {
+			if o, err = msgp.Skip(o); err != nil {
+				return o, err
+			}
+			continue
+		}
+
+		fv, err := fieldByIndexAlloc(v, f.Index)
+		if err != nil {
+			return o, withPath(MsgPack, err, f.Name)
+		}
+		if o, err = readMsgpack(o, fv); err != nil {
+			return o, withPath(MsgPack, err, f.Name)
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,151 @@
+package serialization_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/serialization"
+)
+
+type msgpackInner struct {
+	Tags []string `msg:"tags"`
+}
+
+type msgpackRecord struct {
+	msgpackInner
+
+	ID       uint32            `msg:"id"`
+	Name     string            `json:"name"`
+	Score    float64           `msg:"score,omitempty"`
+	Labels   map[string]string `msg:"labels"`
+	Payload  []byte            `msg:"payload"`
+	Created  time.Time         `msg:"created"`
+	Parent   *msgpackRecord    `msg:"parent"`
+	Ignored  string            `msg:"-"`
+	internal int
+}
+
+func Test_MsgpackReflectRoundTrip(t *testing.T) {
+	in := msgpackRecord{
+		msgpackInner: msgpackInner{Tags: []string{"a", "b"}},
+		ID:           42,
+		Name:         "record",
+		Labels:       map[string]string{"env": "prod"},
+		Payload:      []byte{0x00, 0x01, 0xff},
+		Created:      time.Unix(1600000000, 0).UTC(),
+		Parent:       &msgpackRecord{ID: 1, Name: "parent"},
+		Ignored:      "skipped",
+	}
+
+	data, err := serialization.Marshal(&in, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out msgpackRecord
+	if err := serialization.Unmarshal(data, &out, serialization.MsgPack); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+
+	in.Ignored = ""
+	if !out.Created.Equal(in.Created) {
+		t.Errorf("created = %s, want %s", out.Created, in.Created)
+	}
+	out.Created = in.Created
+	if out.Parent == nil || out.Parent.ID != 1 || out.Parent.Name != "parent" {
+		t.Errorf("parent = %+v, want %+v", out.Parent, in.Parent)
+	}
+	in.Parent, out.Parent = nil, nil
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func Test_MsgpackReflectPrimitives(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		out  interface{}
+	}{
+		{"int", 12, new(int)},
+		{"string", "hello", new(string)},
+		{"slice", []int{1, 2, 3}, new([]int)},
+		{"map", map[string]int{"a": 1}, new(map[string]int)},
+		{"int keys", map[int]bool{1: true}, new(map[int]bool)},
+		{"generic", map[string]interface{}{"a": "b"}, new(map[string]interface{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := serialization.Encode(tt.in, &buf, serialization.MsgPack); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+			if err := serialization.Decode(&buf, tt.out, serialization.MsgPack); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if got := reflect.ValueOf(tt.out).Elem().Interface(); !reflect.DeepEqual(got, tt.in) {
+				t.Errorf("round trip = %v, want %v", got, tt.in)
+			}
+		})
+	}
+}
+
+func Test_MsgpackReflectOverflow(t *testing.T) {
+	data, err := serialization.Marshal(1000, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out int8
+	if err := serialization.Unmarshal(data, &out, serialization.MsgPack); err == nil {
+		t.Error("expected an overflow error")
+	}
+}
+
+func Test_MsgpackReflectHostileLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		out  interface{}
+	}{
+		{"array", []byte{0xdd, 0x04, 0x00, 0x00, 0x00}, &[]int64{}},
+		{"map", []byte{0xdf, 0x04, 0x00, 0x00, 0x00, 0x01, 0x01}, &map[int]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := serialization.Unmarshal(tt.data, tt.out, serialization.MsgPack); err == nil {
+				t.Error("Unmarshal() expected an error for a length larger than the payload")
+			}
+		})
+	}
+}
+
+type msgpackHidden struct {
+	Value int `msg:"value"`
+}
+
+type msgpackEmbedding struct {
+	*msgpackHidden
+	Name string `msg:"name"`
+}
+
+func Test_MsgpackReflectUnexportedEmbeddedPointer(t *testing.T) {
+	data, err := serialization.Marshal(map[string]interface{}{"name": "a", "value": 1}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out msgpackEmbedding
+	if err := serialization.Unmarshal(data, &out, serialization.MsgPack); err == nil {
+		t.Error("Unmarshal() expected an error for a nil pointer to an unexported embedded struct")
+	}
+}
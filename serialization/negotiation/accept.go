@@ -0,0 +1,168 @@
+package negotiation
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/purposed/good/serialization"
+)
+
+// MediaRange is a single entry of an Accept header.
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Q       float64
+	Params  map[string]string
+}
+
+// String returns the media range without its parameters.
+func (m MediaRange) String() string {
+	return m.Type + "/" + m.Subtype
+}
+
+// specificity ranks how precisely the range designates a media type.
+func (m MediaRange) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	case len(m.Params) == 0:
+		return 2
+	}
+	return 3
+}
+
+// matches returns whether the range accepts the given format.
+func (m MediaRange) matches(format serialization.Format) bool {
+	if m.Type == "*" {
+		return true
+	}
+
+	if m.Subtype == "*" {
+		parts := strings.SplitN(string(format), "/", 2)
+		return len(parts) == 2 && parts[0] == m.Type
+	}
+
+	// Aliases may have another top-level type than their format (e.g. application/yaml).
+	if canonical, ok := serialization.Resolve(serialization.Format(m.String())); ok {
+		offer, _ := serialization.Resolve(format)
+		return canonical == offer
+	}
+	return string(format) == m.String()
+}
+
+// ParseAccept parses an Accept header into media ranges, ordered by
+// decreasing preference. Malformed entries are skipped.
+func ParseAccept(header string) []MediaRange {
+	var ranges []MediaRange
+
+	for _, entry := range strings.Split(header, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		segments := strings.Split(entry, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(segments[0]))
+		if mediaType == "*" {
+			mediaType = "*/*"
+		}
+
+		parts := strings.SplitN(mediaType, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || (parts[0] == "*" && parts[1] != "*") {
+			continue
+		}
+
+		mr := MediaRange{Type: parts[0], Subtype: parts[1], Q: 1}
+		valid := true
+		for _, param := range segments[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+
+			if key == "q" {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				mr.Q = q
+				continue
+			}
+
+			if mr.Params == nil {
+				mr.Params = make(map[string]string)
+			}
+			mr.Params[key] = value
+		}
+
+		if valid {
+			ranges = append(ranges, mr)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// defaultOffers lists every registered format, JSON first.
+func defaultOffers() []serialization.Format {
+	offers := []serialization.Format{serialization.JSON}
+	for _, format := range serialization.Formats() {
+		if format != serialization.JSON {
+			offers = append(offers, format)
+		}
+	}
+	return offers
+}
+
+// Negotiate picks the offered format best matching the Accept header.
+// Offers are listed in order of server preference, which breaks ties; when
+// no offers are given, every registered format is considered.
+// An empty header accepts the first offer.
+func Negotiate(accept string, offers ...serialization.Format) (serialization.Format, bool) {
+	if len(offers) == 0 {
+		offers = defaultOffers()
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := ParseAccept(accept)
+
+	var (
+		best  serialization.Format
+		bestQ float64
+		found bool
+	)
+	for _, offer := range offers {
+		canonical, ok := serialization.Resolve(offer)
+		if !ok {
+			continue
+		}
+
+		// The most specific matching range decides the quality of the offer.
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if mr.matches(canonical) && mr.specificity() > specificity {
+				q, specificity = mr.Q, mr.specificity()
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ, found = canonical, q, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,108 @@
+package negotiation
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/purposed/good/serialization"
+)
+
+// Negotiation errors.
+var (
+	ErrNotAcceptable        = errors.New("no acceptable format")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+type contextKey int
+
+const responseFormatKey contextKey = iota
+
+// RequestFormat returns the registered format matching the Content-Type of the request.
+func RequestFormat(r *http.Request) (serialization.Format, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return "", ErrUnsupportedMediaType
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrUnsupportedMediaType
+	}
+
+	format, ok := serialization.Resolve(serialization.Format(mediaType))
+	if !ok {
+		return "", ErrUnsupportedMediaType
+	}
+	return format, nil
+}
+
+// ResponseFormat returns the format to use for the response, either as chosen
+// by Middleware or negotiated from the Accept header of the request.
+func ResponseFormat(r *http.Request, offers ...serialization.Format) (serialization.Format, error) {
+	if format, ok := r.Context().Value(responseFormatKey).(serialization.Format); ok {
+		return format, nil
+	}
+
+	format, ok := Negotiate(r.Header.Get("Accept"), offers...)
+	if !ok {
+		return "", ErrNotAcceptable
+	}
+	return format, nil
+}
+
+// DecodeRequest decodes the request body into outStruct according to its Content-Type.
+func DecodeRequest(r *http.Request, outStruct interface{}) error {
+	format, err := RequestFormat(r)
+	if err != nil {
+		return err
+	}
+	return serialization.Decode(r.Body, outStruct, format)
+}
+
+// WriteResponse encodes inStruct in the negotiated format and writes it
+// with the matching Content-Type and the given status code.
+func WriteResponse(w http.ResponseWriter, r *http.Request, status int, inStruct interface{}) error {
+	format, err := ResponseFormat(r)
+	if err != nil {
+		return err
+	}
+
+	data, err := serialization.Marshal(inStruct, format)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+// Middleware rejects requests whose body cannot be decoded (415) or whose
+// Accept header cannot be satisfied (406). The negotiated response format
+// is made available to the wrapped handler through ResponseFormat.
+func Middleware(next http.Handler, offers ...serialization.Format) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasBody(r) {
+			if _, err := RequestFormat(r); err != nil {
+				http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		format, ok := Negotiate(r.Header.Get("Accept"), offers...)
+		if !ok {
+			http.Error(w, ErrNotAcceptable.Error(), http.StatusNotAcceptable)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), responseFormatKey, format)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
@@ -0,0 +1,115 @@
+package negotiation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+	"github.com/purposed/good/serialization/negotiation"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   serialization.Format
+		wantOk bool
+	}{
+		{"empty header", "", serialization.JSON, true},
+		{"exact", "application/msgpack", serialization.MsgPack, true},
+		{"alias", "application/x-msgpack", serialization.MsgPack, true},
+		{"alias of another type", "application/yaml", serialization.YAML, true},
+		{"q values", "application/json;q=0.5, text/x-yaml;q=0.8", serialization.YAML, true},
+		{"wildcard", "*/*", serialization.JSON, true},
+		{"subtype wildcard", "text/*", serialization.YAML, true},
+		{"specific overrides wildcard", "application/*;q=0.9, application/json;q=0", serialization.MsgPack, true},
+		{"refused", "application/json;q=0", "", false},
+		{"unknown", "image/png", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := negotiation.Negotiate(tt.accept, offers...)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Negotiate() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestNegotiate_XMLAlias(t *testing.T) {
+	got, ok := negotiation.Negotiate("text/xml", serialization.XML)
+	if got != serialization.XML || !ok {
+		t.Errorf("Negotiate() = %s, %v, want %s, true", got, ok, serialization.XML)
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := negotiation.ParseAccept("text/*;q=0.3, text/html;q=0.7, text/html;level=1, */*;q=0.5")
+
+	want := []string{"text/html", "text/html", "*/*", "text/*"}
+	if len(ranges) != len(want) {
+		t.Errorf("ParseAccept() returned %d ranges, want %d", len(ranges), len(want))
+		return
+	}
+	for i, mr := range ranges {
+		if mr.String() != want[i] {
+			t.Errorf("range %d = %s, want %s", i, mr.String(), want[i])
+		}
+	}
+	if ranges[0].Params["level"] != "1" {
+		t.Errorf("most specific range should come first, got %+v", ranges[0])
+	}
+}
+
+type message struct {
+	Text string `json:"text" yaml:"text"`
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := negotiation.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in message
+		if err := negotiation.DecodeRequest(r, &in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := negotiation.WriteResponse(w, r, http.StatusOK, &in); err != nil {
+			t.Errorf("WriteResponse() error = %s", err.Error())
+		}
+	}))
+
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		wantStatus  int
+		wantType    string
+	}{
+		{"json to yaml", "application/json", "text/x-yaml", http.StatusOK, "text/x-yaml"},
+		{"json with charset", "application/json; charset=utf-8", "", http.StatusOK, "application/json"},
+		{"unsupported body", "text/plain", "", http.StatusUnsupportedMediaType, ""},
+		{"not acceptable", "application/json", "image/png", http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"text":"hello"}`))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %s, want %s", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+		})
+	}
+}
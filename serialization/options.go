@@ -0,0 +1,162 @@
+package serialization
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MsgpackTimeFormat selects how the reflection-based msgpack codec encodes time.Time values.
+type MsgpackTimeFormat int
+
+// Available msgpack time formats. Decoding accepts any of them.
+const (
+	// MsgpackTimeExtension uses the msgp time extension (type 5), as generated code does.
+	MsgpackTimeExtension MsgpackTimeFormat = iota
+	// MsgpackTimestamp uses the official msgpack timestamp extension (type -1).
+	MsgpackTimestamp
+	// MsgpackTimeUnixNano encodes the number of nanoseconds since the epoch as an integer.
+	MsgpackTimeUnixNano
+	// MsgpackTimeRFC3339 encodes times as RFC 3339 strings.
+	MsgpackTimeRFC3339
+)
+
+// msgpackTimestampType is the extension type of official msgpack timestamps.
+const msgpackTimestampType = 0xff
+
+// EncodeOptions configures encoding. The zero value matches the default output of each format.
+type EncodeOptions struct {
+	// Indent pretty-prints JSON and XML using the given indentation string, and
+	// indents nested TOML tables with it. YAML uses its length as the number of
+	// spaces to indent with.
+	Indent string
+
+	// DisableHTMLEscaping keeps <, > and & as is in JSON strings.
+	DisableHTMLEscaping bool
+
+	// SortMapKeys writes msgpack map entries sorted by key, and cbor map entries
+	// in canonical order. JSON and YAML always sort map keys.
+	SortMapKeys bool
+
+	// CompactFloats writes msgpack float64 values as float32, and cbor floats in
+	// their shortest encoding, when no precision is lost.
+	// JSON and YAML always use the shortest representation.
+	CompactFloats bool
+
+	// MsgpackTime selects the msgpack encoding of time.Time values.
+	MsgpackTime MsgpackTimeFormat
+}
+
+// ConfigurableEncoder is implemented by serializers accepting per-call encode options.
+type ConfigurableEncoder interface {
+	MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error)
+	EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error
+}
+
+// MarshalWithOptions dumps the struct to bytes in the correct format,
+// using opts instead of the options of the serializer.
+func MarshalWithOptions(inStruct interface{}, format Format, opts EncodeOptions) ([]byte, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+
+	configurable, ok := s.(ConfigurableEncoder)
+	if !ok {
+		return nil, fmt.Errorf("format does not support encode options: %s", format)
+	}
+	return configurable.MarshalWithOptions(inStruct, opts)
+}
+
+// EncodeWithOptions encodes the struct in the correct format & writes it to the writer,
+// using opts instead of the options of the serializer.
+func EncodeWithOptions(inStruct interface{}, w io.Writer, format Format, opts EncodeOptions) error {
+	s, ok := Lookup(format)
+	if !ok {
+		return unknownFormat(format)
+	}
+
+	configurable, ok := s.(ConfigurableEncoder)
+	if !ok {
+		return fmt.Errorf("format does not support encode options: %s", format)
+	}
+	return configurable.EncodeWithOptions(inStruct, w, opts)
+}
+
+// appendTime appends a time in the configured msgpack time format.
+func (e msgpackEncoder) appendTime(b []byte, t time.Time) []byte {
+	switch e.opts.MsgpackTime {
+	case MsgpackTimestamp:
+		return appendMsgpackTimestamp(b, t)
+	case MsgpackTimeUnixNano:
+		return msgp.AppendInt64(b, t.UnixNano())
+	case MsgpackTimeRFC3339:
+		return msgp.AppendString(b, t.Format(time.RFC3339Nano))
+	}
+	return msgp.AppendTime(b, t)
+}
+
+// appendMsgpackTimestamp appends t as an official msgpack timestamp,
+// using the smallest of the 32, 64 and 96 bit layouts.
+func appendMsgpackTimestamp(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+
+	if sec>>34 == 0 {
+		data := uint64(nsec)<<34 | uint64(sec)
+		if data&0xffffffff00000000 == 0 {
+			var raw [6]byte
+			raw[0], raw[1] = 0xd6, msgpackTimestampType
+			binary.BigEndian.PutUint32(raw[2:], uint32(data))
+			return append(b, raw[:]...)
+		}
+
+		var raw [10]byte
+		raw[0], raw[1] = 0xd7, msgpackTimestampType
+		binary.BigEndian.PutUint64(raw[2:], data)
+		return append(b, raw[:]...)
+	}
+
+	var raw [15]byte
+	raw[0], raw[1], raw[2] = 0xc7, 12, msgpackTimestampType
+	binary.BigEndian.PutUint32(raw[3:], uint32(nsec))
+	binary.BigEndian.PutUint64(raw[7:], uint64(sec))
+	return append(b, raw[:]...)
+}
+
+// readMsgpackTime reads a time encoded in any of the msgpack time formats.
+func readMsgpackTime(b []byte) (time.Time, []byte, error) {
+	switch msgp.NextType(b) {
+	case msgp.IntType, msgp.UintType:
+		nsec, o, err := msgp.ReadInt64Bytes(b)
+		return time.Unix(0, nsec), o, err
+	case msgp.StrType:
+		s, o, err := msgp.ReadStringBytes(b)
+		if err != nil {
+			return time.Time{}, b, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t, o, err
+	case msgp.ExtensionType:
+		return readMsgpackTimestamp(b)
+	}
+	return msgp.ReadTimeBytes(b)
+}
+
+func readMsgpackTimestamp(b []byte) (time.Time, []byte, error) {
+	switch {
+	case len(b) >= 6 && b[0] == 0xd6 && b[1] == msgpackTimestampType:
+		sec := binary.BigEndian.Uint32(b[2:6])
+		return time.Unix(int64(sec), 0), b[6:], nil
+	case len(b) >= 10 && b[0] == 0xd7 && b[1] == msgpackTimestampType:
+		data := binary.BigEndian.Uint64(b[2:10])
+		return time.Unix(int64(data&0x3ffffffff), int64(data>>34)), b[10:], nil
+	case len(b) >= 15 && b[0] == 0xc7 && b[1] == 12 && b[2] == msgpackTimestampType:
+		nsec := binary.BigEndian.Uint32(b[3:7])
+		sec := int64(binary.BigEndian.Uint64(b[7:15]))
+		return time.Unix(sec, int64(nsec)), b[15:], nil
+	}
+	return time.Time{}, b, fmt.Errorf("msgpack: not a timestamp extension")
+}
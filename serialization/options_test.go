@@ -0,0 +1,121 @@
+package serialization_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/serialization"
+)
+
+type optionsDocument struct {
+	Link string `json:"link" yaml:"link"`
+	List []int  `json:"list" yaml:"list"`
+}
+
+func Test_JSONEncodeOptions(t *testing.T) {
+	in := optionsDocument{Link: "<a>", List: []int{1}}
+
+	data, err := serialization.MarshalWithOptions(&in, serialization.JSON, serialization.EncodeOptions{
+		Indent:              "  ",
+		DisableHTMLEscaping: true,
+	})
+	if err != nil {
+		t.Errorf("MarshalWithOptions() error = %s", err.Error())
+		return
+	}
+
+	want := "{\n  \"link\": \"<a>\",\n  \"list\": [\n    1\n  ]\n}"
+	if string(data) != want {
+		t.Errorf("MarshalWithOptions() =\n%s\nwant\n%s", data, want)
+	}
+
+	defaults, _ := serialization.Marshal(&in, serialization.JSON)
+	if string(defaults) != `{"link":"\u003ca\u003e","list":[1]}` {
+		t.Errorf("Marshal() = %s, defaults should be unchanged", defaults)
+	}
+}
+
+func Test_SerializerEncodeOptions(t *testing.T) {
+	s := &serialization.YAMLSerializer{EncodeOptions: serialization.EncodeOptions{Indent: "  "}}
+
+	var buf bytes.Buffer
+	if err := s.Encode(&optionsDocument{List: []int{1}}, &buf); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+
+	want := "link: \"\"\nlist:\n  - 1\n"
+	if buf.String() != want {
+		t.Errorf("Encode() =\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func Test_MsgpackEncodeOptions(t *testing.T) {
+	m := map[string]float64{"b": 1.5, "a": 0.1, "c": 2}
+
+	sorted := serialization.EncodeOptions{SortMapKeys: true}
+	first, _ := serialization.MarshalWithOptions(m, serialization.MsgPack, sorted)
+	for i := 0; i < 10; i++ {
+		again, _ := serialization.MarshalWithOptions(m, serialization.MsgPack, sorted)
+		if !bytes.Equal(first, again) {
+			t.Error("sorted map encoding is not deterministic")
+			return
+		}
+	}
+
+	compact, _ := serialization.MarshalWithOptions(m, serialization.MsgPack, serialization.EncodeOptions{SortMapKeys: true, CompactFloats: true})
+	if len(compact) >= len(first) {
+		t.Errorf("compact floats did not shrink the payload: %d >= %d", len(compact), len(first))
+	}
+
+	var out map[string]float64
+	if err := serialization.Unmarshal(compact, &out, serialization.MsgPack); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	if out["a"] != 0.1 || out["b"] != 1.5 || out["c"] != 2 {
+		t.Errorf("Unmarshal() = %v", out)
+	}
+}
+
+func Test_MsgpackTimeFormats(t *testing.T) {
+	type event struct {
+		At time.Time `msg:"at"`
+	}
+	times := []time.Time{
+		time.Unix(1600000000, 0),
+		time.Unix(1600000000, 123456789),
+		time.Unix(1<<35, 5),
+		time.Unix(-10, 0),
+	}
+	formats := []serialization.MsgpackTimeFormat{
+		serialization.MsgpackTimeExtension,
+		serialization.MsgpackTimestamp,
+		serialization.MsgpackTimeUnixNano,
+		serialization.MsgpackTimeRFC3339,
+	}
+
+	for _, format := range formats {
+		for _, at := range times {
+			if format == serialization.MsgpackTimeUnixNano && at.Unix() > 1<<33 {
+				continue
+			}
+
+			data, err := serialization.MarshalWithOptions(&event{At: at}, serialization.MsgPack, serialization.EncodeOptions{MsgpackTime: format})
+			if err != nil {
+				t.Errorf("MarshalWithOptions() error = %s", err.Error())
+				continue
+			}
+
+			var out event
+			if err := serialization.Unmarshal(data, &out, serialization.MsgPack); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				continue
+			}
+			if !out.At.Equal(at) {
+				t.Errorf("format %d: time = %s, want %s", format, out.At, at)
+			}
+		}
+	}
+}
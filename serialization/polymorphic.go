@@ -0,0 +1,652 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pelletier/go-toml"
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// Typed is the envelope of a polymorphic value, tagged with the name of its type.
+type Typed struct {
+	Type string      `json:"type" msg:"type" yaml:"type" toml:"type"`
+	Data interface{} `json:"data" msg:"data" yaml:"data" toml:"data"`
+}
+
+// TypeRegistry maps type names to concrete types.
+type TypeRegistry struct {
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+	lock  sync.RWMutex
+}
+
+// NewTypeRegistry returns an empty type registry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		types: make(map[string]reflect.Type),
+		names: make(map[reflect.Type]string),
+	}
+}
+
+// Register associates name to the type of sample. Registering a pointer
+// sample decodes values of that name to pointers.
+func (r *TypeRegistry) Register(name string, sample interface{}) {
+	t := reflect.TypeOf(sample)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if previous, ok := r.types[name]; ok {
+		delete(r.names, previous)
+	}
+	r.types[name] = t
+	r.names[t] = name
+}
+
+// TypeName returns the name the type of v is registered under.
+func (r *TypeRegistry) TypeName(v interface{}) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	name, ok := r.names[reflect.TypeOf(v)]
+	return name, ok
+}
+
+// New returns a pointer to a new zero value of the type registered under name.
+func (r *TypeRegistry) New(name string) (interface{}, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	t, ok := r.types[name]
+	if !ok {
+		return nil, false
+	}
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface(), true
+	}
+	return reflect.New(t).Interface(), true
+}
+
+// value converts a decoded pointer back to the kind of sample registered under name.
+func (r *TypeRegistry) value(name string, ptr interface{}) interface{} {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if t := r.types[name]; t != nil && t.Kind() == reflect.Ptr {
+		return ptr
+	}
+	return reflect.ValueOf(ptr).Elem().Interface()
+}
+
+func (r *TypeRegistry) wrap(v interface{}) (*Typed, error) {
+	name, ok := r.TypeName(v)
+	if !ok {
+		return nil, &UnsupportedTypeError{Type: reflect.TypeOf(v), Reason: "not registered"}
+	}
+	return &Typed{Type: name, Data: v}, nil
+}
+
+// decode decodes data with unmarshal into a new value of the type registered under name.
+func (r *TypeRegistry) decode(name string, unmarshal func(interface{}) error) (interface{}, error) {
+	ptr, ok := r.New(name)
+	if !ok {
+		return nil, fmt.Errorf("unregistered type name: %s", name)
+	}
+	if err := unmarshal(ptr); err != nil {
+		return nil, err
+	}
+	return r.value(name, ptr), nil
+}
+
+var defaultTypes = NewTypeRegistry()
+
+// RegisterType associates name to the type of sample in the default type registry.
+func RegisterType(name string, sample interface{}) {
+	defaultTypes.Register(name, sample)
+}
+
+// TypedSerializer serializes values of registered types in a Typed envelope,
+// so they can be decoded back to their concrete type.
+//
+// Unmarshal and Decode accept a pointer to an interface the concrete type
+// implements, or a pointer to the concrete type itself.
+type TypedSerializer struct {
+	Format Format
+
+	// Types holds the registered types. Defaults to the types registered with RegisterType.
+	// Polymorphic values without a registry of their own, in the values encoded
+	// and in the decoded concrete values before decoding, are given Types.
+	Types *TypeRegistry
+}
+
+func (m *TypedSerializer) types() *TypeRegistry {
+	if m.Types == nil {
+		return defaultTypes
+	}
+	return m.Types
+}
+
+// wrap returns the typed envelope of inStruct, binding the registry to its Polymorphic values.
+func (m *TypedSerializer) wrap(inStruct interface{}) (*Typed, error) {
+	envelope, err := m.types().wrap(inStruct)
+	if err != nil {
+		return nil, err
+	}
+	if m.Types != nil {
+		// The value is copied so values stored in interfaces can be bound as well.
+		v := reflect.New(reflect.TypeOf(inStruct)).Elem()
+		v.Set(reflect.ValueOf(inStruct))
+		bindTypes(v, m.Types, make(map[uintptr]bool))
+		envelope.Data = v.Interface()
+	}
+	return envelope, nil
+}
+
+// Marshal wraps inStruct in a typed envelope and serializes it.
+func (m *TypedSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	envelope, err := m.wrap(inStruct)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(envelope, m.Format)
+}
+
+// Unmarshal decodes a typed envelope and stores its value in outStruct.
+func (m *TypedSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	var doc interface{}
+	if err := Unmarshal(rawBytes, &doc, m.Format); err != nil {
+		return err
+	}
+
+	name, payload, err := unwrapTyped(doc)
+	if err != nil {
+		return err
+	}
+
+	// The payload is round-tripped through the format to fill the concrete type.
+	data, err := Marshal(payload, m.Format)
+	if err != nil {
+		return err
+	}
+	value, err := m.types().decode(name, func(ptr interface{}) error {
+		if m.Types != nil {
+			bindTypes(reflect.ValueOf(ptr), m.Types, make(map[uintptr]bool))
+		}
+		return Unmarshal(data, ptr, m.Format)
+	})
+	if err != nil {
+		return err
+	}
+	return assignTyped(outStruct, value)
+}
+
+// Encode wraps the struct in a typed envelope and writes it to a stream.
+func (m *TypedSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	envelope, err := m.wrap(inStruct)
+	if err != nil {
+		return err
+	}
+	return Encode(envelope, w, m.Format)
+}
+
+// Decode reads a whole typed envelope from the stream and stores its value in outStruct.
+func (m *TypedSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(data, outStruct)
+}
+
+// unwrapTyped extracts the type name and payload of a generic document.
+func unwrapTyped(doc interface{}) (string, interface{}, error) {
+	var envelope map[string]interface{}
+	switch x := doc.(type) {
+	case map[string]interface{}:
+		envelope = x
+	case map[interface{}]interface{}:
+		envelope = make(map[string]interface{}, len(x))
+		for k, v := range x {
+			if key, ok := k.(string); ok {
+				envelope[key] = v
+			}
+		}
+	default:
+		return "", nil, errors.New("invalid typed envelope")
+	}
+
+	name, ok := envelope["type"].(string)
+	if !ok {
+		return "", nil, errors.New("invalid typed envelope: missing type")
+	}
+	return name, envelope["data"], nil
+}
+
+// assignTyped stores value in the variable outStruct points to.
+func assignTyped(outStruct interface{}, value interface{}) error {
+	out := reflect.ValueOf(outStruct)
+	if out.Kind() != reflect.Ptr || out.IsNil() {
+		return &UnsupportedTypeError{Type: reflect.TypeOf(outStruct), Reason: "outStruct must be a non-nil pointer"}
+	}
+
+	target := out.Elem()
+	v := reflect.ValueOf(value)
+	switch {
+	case value == nil:
+		target.Set(reflect.Zero(target.Type()))
+	case v.Type().AssignableTo(target.Type()):
+		target.Set(v)
+	case v.Kind() == reflect.Ptr && v.Elem().Type().AssignableTo(target.Type()):
+		target.Set(v.Elem())
+	default:
+		return fmt.Errorf("cannot assign %s to %s", v.Type(), target.Type())
+	}
+	return nil
+}
+
+// bindTypes sets the registry of the Polymorphic values reachable from v
+// through pointers, struct fields, arrays and slices, which have none.
+// Visited pointers are recorded in seen.
+func bindTypes(v reflect.Value, types *TypeRegistry, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		bindTypes(v.Elem(), types, seen)
+	case reflect.Interface:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Ptr {
+			bindTypes(v.Elem(), types, seen)
+		}
+	case reflect.Struct:
+		if v.Type() == polymorphicType {
+			if field := v.FieldByName("Types"); field.CanSet() && field.IsNil() {
+				field.Set(reflect.ValueOf(types))
+			}
+			bindTypes(v.FieldByName("Value"), types, seen)
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				bindTypes(v.Field(i), types, seen)
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			bindTypes(v.Index(i), types, seen)
+		}
+	}
+}
+
+// Polymorphic holds a value of a registered type, for use in interface-typed
+// fields. It is serialized as a Typed envelope by the json, msgpack, yaml,
+// cbor and toml serializers, and decoded back to the registered concrete type.
+// Values of unregistered types fail to encode.
+type Polymorphic struct {
+	Value interface{}
+
+	// Types resolves the names of the types. Defaults to the types registered with RegisterType.
+	// To decode with another registry, set it in the target before decoding.
+	// go-toml allocates the values it decodes, so toml decoding always uses the default.
+	Types *TypeRegistry
+}
+
+var polymorphicType = reflect.TypeOf(Polymorphic{})
+
+func (p Polymorphic) types() *TypeRegistry {
+	if p.Types == nil {
+		return defaultTypes
+	}
+	return p.Types
+}
+
+// generic returns the typed envelope of the value in the generic representation.
+func (p Polymorphic) generic() (interface{}, error) {
+	if p.Value == nil {
+		return nil, nil
+	}
+	envelope, err := p.types().wrap(p.Value)
+	if err != nil {
+		return nil, err
+	}
+	data, err := toGeneric(reflect.ValueOf(envelope.Data))
+	if err != nil {
+		return nil, err
+	}
+	return OrderedMap{
+		{Key: "type", Value: envelope.Type},
+		{Key: "data", Value: data},
+	}, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p Polymorphic) MarshalJSON() ([]byte, error) {
+	if p.Value == nil {
+		return []byte("null"), nil
+	}
+	envelope, err := p.types().wrap(p.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Polymorphic) UnmarshalJSON(data []byte) error {
+	var envelope struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if envelope.Type == "" {
+		p.Value = nil
+		return nil
+	}
+
+	value, err := p.types().decode(envelope.Type, func(ptr interface{}) error {
+		return json.Unmarshal(envelope.Data, ptr)
+	})
+	if err != nil {
+		return err
+	}
+	p.Value = value
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler. A nil value is encoded as an empty
+// mapping, since yaml drops null sequence items decoded into structs.
+func (p Polymorphic) MarshalYAML() (interface{}, error) {
+	if p.Value == nil {
+		return struct{}{}, nil
+	}
+	return p.types().wrap(p.Value)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Polymorphic) UnmarshalYAML(node *yaml.Node) error {
+	var envelope struct {
+		Type string    `yaml:"type"`
+		Data yaml.Node `yaml:"data"`
+	}
+	if err := node.Decode(&envelope); err != nil {
+		return err
+	}
+	if envelope.Type == "" {
+		p.Value = nil
+		return nil
+	}
+
+	value, err := p.types().decode(envelope.Type, envelope.Data.Decode)
+	if err != nil {
+		return err
+	}
+	p.Value = value
+	return nil
+}
+
+// MarshalCBOR implements cbor.Marshaler.
+func (p Polymorphic) MarshalCBOR() ([]byte, error) {
+	if p.Value == nil {
+		return []byte{0xf6}, nil // null
+	}
+	envelope, err := p.types().wrap(p.Value)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := cborEncMode(EncodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return mode.Marshal(envelope)
+}
+
+// UnmarshalCBOR implements cbor.Unmarshaler.
+func (p *Polymorphic) UnmarshalCBOR(data []byte) error {
+	var envelope struct {
+		Type string          `cbor:"type"`
+		Data cbor.RawMessage `cbor:"data"`
+	}
+	if err := cbor.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if envelope.Type == "" {
+		p.Value = nil
+		return nil
+	}
+
+	value, err := p.types().decode(envelope.Type, func(ptr interface{}) error {
+		return cbor.Unmarshal(envelope.Data, ptr)
+	})
+	if err != nil {
+		return err
+	}
+	p.Value = value
+	return nil
+}
+
+// MarshalTOML implements toml.Marshaler. The envelope is written as an inline
+// table, and a nil value as an empty one since toml has no null.
+func (p Polymorphic) MarshalTOML() ([]byte, error) {
+	if p.Value == nil {
+		return []byte("{}"), nil
+	}
+	envelope, err := p.types().wrap(p.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// go-toml names and converts the fields of the value, in a document
+	// read back so it can be written inline.
+	doc, err := toml.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := toml.LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeTOMLInline(&buf, tree.ToMap()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalTOML implements toml.Unmarshaler.
+func (p *Polymorphic) UnmarshalTOML(v interface{}) error {
+	envelope, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("invalid typed envelope")
+	}
+	name, _ := envelope["type"].(string)
+	if name == "" {
+		p.Value = nil
+		return nil
+	}
+
+	value, err := p.types().decode(name, func(ptr interface{}) error {
+		return unmarshalTOMLValue(envelope["data"], ptr)
+	})
+	if err != nil {
+		return err
+	}
+	p.Value = value
+	return nil
+}
+
+// unmarshalTOMLValue decodes a value read by go-toml into ptr. Toml documents
+// are tables, so the value is decoded as the field of a struct.
+func unmarshalTOMLValue(v interface{}, ptr interface{}) error {
+	if v == nil {
+		return nil
+	}
+	doc, err := toml.Marshal(map[string]interface{}{"v": v})
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(ptr).Elem()
+	wrapper := reflect.New(reflect.StructOf([]reflect.StructField{
+		{Name: "V", Type: target.Type(), Tag: `toml:"v"`},
+	}))
+	if err := toml.Unmarshal(doc, wrapper.Interface()); err != nil {
+		return err
+	}
+	target.Set(wrapper.Elem().Field(0))
+	return nil
+}
+
+// writeTOMLInline writes a value read by go-toml as an inline toml value.
+func writeTOMLInline(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte(' ')
+			// Json strings are valid toml basic strings.
+			quoted, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(quoted)
+			buf.WriteString(" = ")
+			if err := writeTOMLInline(buf, x[key]); err != nil {
+				return err
+			}
+		}
+		if len(keys) > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeTOMLInline(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		quoted, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		buf.Write(quoted)
+	case bool, int64, uint64, toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		fmt.Fprint(buf, x)
+	case float64:
+		switch {
+		case math.IsNaN(x):
+			buf.WriteString("nan")
+		case math.IsInf(x, 1):
+			buf.WriteString("inf")
+		case math.IsInf(x, -1):
+			buf.WriteString("-inf")
+		default:
+			buf.WriteString(formatFloat(x))
+		}
+	case time.Time:
+		buf.WriteString(x.Format(time.RFC3339Nano))
+	default:
+		return &UnsupportedTypeError{Type: reflect.TypeOf(v), Reason: "not a toml value"}
+	}
+	return nil
+}
+
+// MarshalMsg implements msgp.Marshaler.
+func (p Polymorphic) MarshalMsg(b []byte) ([]byte, error) {
+	if p.Value == nil {
+		return msgp.AppendNil(b), nil
+	}
+	envelope, err := p.types().wrap(p.Value)
+	if err != nil {
+		return b, err
+	}
+
+	b = msgp.AppendMapHeader(b, 2)
+	b = msgp.AppendString(b, "type")
+	b = msgp.AppendString(b, envelope.Type)
+	b = msgp.AppendString(b, "data")
+	return msgpackEncoder{}.append(b, reflect.ValueOf(envelope.Data))
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler.
+func (p *Polymorphic) UnmarshalMsg(b []byte) ([]byte, error) {
+	if msgp.IsNil(b) {
+		p.Value = nil
+		return b[1:], nil
+	}
+
+	size, b, err := msgp.ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+
+	var (
+		name string
+		data []byte
+	)
+	for i := uint32(0); i < size; i++ {
+		var key []byte
+		if key, b, err = msgp.ReadMapKeyZC(b); err != nil {
+			return b, err
+		}
+
+		switch string(key) {
+		case "type":
+			if name, b, err = msgp.ReadStringBytes(b); err != nil {
+				return b, err
+			}
+		case "data":
+			rest, err := msgp.Skip(b)
+			if err != nil {
+				return b, err
+			}
+			data, b = b[:len(b)-len(rest)], rest
+		default:
+			if b, err = msgp.Skip(b); err != nil {
+				return b, err
+			}
+		}
+	}
+	if name == "" {
+		return b, errors.New("invalid typed envelope: missing type")
+	}
+
+	value, err := p.types().decode(name, func(ptr interface{}) error {
+		return (&MsgpackSerializer{}).Unmarshal(data, ptr)
+	})
+	if err != nil {
+		return b, err
+	}
+	p.Value = value
+	return b, nil
+}
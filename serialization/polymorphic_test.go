@@ -0,0 +1,205 @@
+package serialization_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type square struct {
+	Side float64 `json:"side" msg:"side" yaml:"side"`
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+type rect struct {
+	Width  float64 `json:"width" msg:"width" yaml:"width"`
+	Height float64 `json:"height" msg:"height" yaml:"height"`
+}
+
+func (r *rect) Area() float64 { return r.Width * r.Height }
+
+type drawing struct {
+	Name   string                      `json:"name" msg:"name" yaml:"name"`
+	Shapes []serialization.Polymorphic `json:"shapes" msg:"shapes" yaml:"shapes"`
+}
+
+func init() {
+	serialization.RegisterType("square", square{})
+	serialization.RegisterType("rect", &rect{})
+}
+
+var polymorphicFormats = []serialization.Format{
+	serialization.JSON,
+	serialization.MsgPack,
+	serialization.YAML,
+	serialization.CBOR,
+	serialization.TOML,
+	serialization.CanonicalJSON,
+	serialization.Compressed(serialization.JSON, serialization.Gzip),
+}
+
+func Test_Polymorphic(t *testing.T) {
+	in := drawing{
+		Name: "d",
+		Shapes: []serialization.Polymorphic{
+			{Value: square{Side: 2}},
+			{Value: &rect{Width: 2, Height: 3}},
+			{},
+		},
+	}
+
+	for _, format := range polymorphicFormats {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := serialization.Marshal(in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out drawing
+			if err := serialization.Unmarshal(data, &out, format); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				return
+			}
+			if !reflect.DeepEqual(in, out) {
+				t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func Test_Polymorphic_Unregistered(t *testing.T) {
+	in := drawing{Shapes: []serialization.Polymorphic{{Value: 42}}}
+
+	for _, format := range polymorphicFormats {
+		if _, err := serialization.Marshal(in, format); err == nil {
+			t.Errorf("Marshal(%s) expected error", format)
+		}
+	}
+}
+
+type circle struct {
+	Radius float64 `json:"radius" msg:"radius" yaml:"radius"`
+}
+
+func (c circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type frame struct {
+	Inner serialization.Polymorphic `json:"inner" msg:"inner" yaml:"inner"`
+}
+
+func (f frame) Area() float64 { return f.Inner.Value.(shape).Area() }
+
+func Test_Polymorphic_Registry(t *testing.T) {
+	registry := serialization.NewTypeRegistry()
+	registry.Register("circle", circle{})
+	registry.Register("frame", frame{})
+
+	for _, format := range polymorphicFormats {
+		t.Run(string(format), func(t *testing.T) {
+			// Polymorphic values use their own registry.
+			in := drawing{Shapes: []serialization.Polymorphic{{Value: circle{Radius: 1}, Types: registry}}}
+			data, err := serialization.Marshal(in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+			out := drawing{Shapes: make([]serialization.Polymorphic, 0, 1)}
+			if err := serialization.Unmarshal(data, &out, format); err == nil {
+				t.Errorf("Unmarshal() expected error for a type missing from the default registry")
+			}
+
+			if format == serialization.TOML {
+				// go-toml decodes into new values, dropping the registry bound to the target.
+				return
+			}
+
+			// TypedSerializer binds its registry to nested values.
+			m := &serialization.TypedSerializer{Format: format, Types: registry}
+			if data, err = m.Marshal(frame{Inner: serialization.Polymorphic{Value: circle{Radius: 2}}}); err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+			var s shape
+			if err := m.Unmarshal(data, &s); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				return
+			}
+			if f, ok := s.(frame); !ok || f.Inner.Value != (circle{Radius: 2}) {
+				t.Errorf("Unmarshal() = %#v", s)
+			}
+		})
+	}
+}
+
+func Test_TypedSerializer(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			m := &serialization.TypedSerializer{Format: format}
+
+			var buf bytes.Buffer
+			if err := m.Encode(&rect{Width: 1, Height: 4}, &buf); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+
+			var out shape
+			if err := m.Decode(&buf, &out); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if _, ok := out.(*rect); !ok || out.Area() != 4 {
+				t.Errorf("Decode() = %#v", out)
+			}
+
+			data, err := m.Marshal(square{Side: 3})
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+			var sq square
+			if err := m.Unmarshal(data, &sq); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				return
+			}
+			if sq.Side != 3 {
+				t.Errorf("Unmarshal() = %+v", sq)
+			}
+
+			var wrong rect
+			if err := m.Unmarshal(data, &wrong); err == nil {
+				t.Errorf("Unmarshal() expected error for mismatched type")
+			}
+		})
+	}
+}
+
+func Test_TypeRegistry(t *testing.T) {
+	registry := serialization.NewTypeRegistry()
+	registry.Register("square", square{})
+
+	if name, ok := registry.TypeName(square{}); !ok || name != "square" {
+		t.Errorf("TypeName() = %s, %v", name, ok)
+	}
+	if _, ok := registry.TypeName(&square{}); ok {
+		t.Errorf("TypeName() expected pointer to be unregistered")
+	}
+	if v, ok := registry.New("square"); !ok || reflect.TypeOf(v) != reflect.TypeOf(&square{}) {
+		t.Errorf("New() = %T, %v", v, ok)
+	}
+	if _, ok := registry.New("circle"); ok {
+		t.Errorf("New() expected unknown type")
+	}
+
+	m := &serialization.TypedSerializer{Format: serialization.JSON, Types: registry}
+	if _, err := m.Marshal(&rect{}); err == nil {
+		t.Errorf("Marshal() expected error for unregistered type")
+	}
+}
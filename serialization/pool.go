@@ -0,0 +1,82 @@
+package serialization
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize bounds the capacity of the buffers kept in pools,
+// so an occasional large message doesn't stay allocated.
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+var bytesPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+func getBytes() *[]byte {
+	return bytesPool.Get().(*[]byte)
+}
+
+func putBytes(b *[]byte) {
+	if cap(*b) <= maxPooledBufferSize {
+		*b = (*b)[:0]
+		bytesPool.Put(b)
+	}
+}
+
+// marshalPooled runs encode on a pooled buffer and returns a copy of what it wrote.
+func marshalPooled(encode func(w io.Writer) error) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := encode(buf); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// Appender is implemented by serializers able to append the encoding of a
+// value to an existing byte slice.
+type Appender interface {
+	MarshalAppend(dst []byte, inStruct interface{}) ([]byte, error)
+}
+
+// MarshalAppend appends the struct, dumped in the correct format, to dst and
+// returns the extended slice. Reusing dst across calls (e.g. dst[:0]) avoids
+// allocating a new buffer for each message.
+func MarshalAppend(dst []byte, inStruct interface{}, format Format) ([]byte, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return dst, unknownFormat(format)
+	}
+
+	if appender, ok := s.(Appender); ok {
+		return appender.MarshalAppend(dst, inStruct)
+	}
+
+	data, err := s.Marshal(inStruct)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
+}
@@ -0,0 +1,191 @@
+package serialization_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type poolBackend struct {
+	Host    string `json:"host" msg:"host" yaml:"host"`
+	Port    int    `json:"port" msg:"port" yaml:"port"`
+	Weight  int    `json:"weight,omitempty" msg:"weight,omitempty" yaml:"weight,omitempty"`
+	Enabled bool   `json:"enabled" msg:"enabled" yaml:"enabled"`
+}
+
+type poolMessage struct {
+	ID       int64         `json:"id" msg:"id" yaml:"id"`
+	Name     string        `json:"name" msg:"name" yaml:"name"`
+	Tags     []string      `json:"tags" msg:"tags" yaml:"tags"`
+	Backends []poolBackend `json:"backends" msg:"backends" yaml:"backends"`
+}
+
+func newPoolMessage() *poolMessage {
+	return &poolMessage{
+		ID:   42,
+		Name: "frontend",
+		Tags: []string{"a", "b", "c"},
+		Backends: []poolBackend{
+			{Host: "10.0.0.1", Port: 8080, Enabled: true},
+			{Host: "10.0.0.2", Port: 8080, Weight: 2},
+		},
+	}
+}
+
+var poolFormats = []serialization.Format{
+	serialization.JSON,
+	serialization.MsgPack,
+	serialization.YAML,
+	serialization.CBOR,
+	serialization.CanonicalJSON,
+	serialization.CanonicalMsgPack,
+	serialization.Compressed(serialization.JSON, "gzip"),
+}
+
+func Test_MarshalAppend(t *testing.T) {
+	in := newPoolMessage()
+	for _, format := range poolFormats {
+		t.Run(string(format), func(t *testing.T) {
+			want, err := serialization.Marshal(in, format)
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			prefix := []byte("prefix")
+			got, err := serialization.MarshalAppend(prefix, in, format)
+			if err != nil {
+				t.Errorf("MarshalAppend() error = %s", err.Error())
+				return
+			}
+			if !bytes.HasPrefix(got, prefix) {
+				t.Errorf("MarshalAppend() = %q, want prefix %q", got, prefix)
+				return
+			}
+
+			// Compressed payloads embed a timestamp, compare the decoded messages instead.
+			var out poolMessage
+			if err := serialization.Unmarshal(got[len(prefix):], &out, format); err != nil {
+				t.Errorf("Unmarshal() error = %s", err.Error())
+				return
+			}
+			if format != serialization.Compressed(serialization.JSON, "gzip") && !bytes.Equal(got[len(prefix):], want) {
+				t.Errorf("MarshalAppend() = %q, want %q", got[len(prefix):], want)
+			}
+		})
+	}
+}
+
+func Test_MarshalAppend_Options(t *testing.T) {
+	s := &serialization.JSONSerializer{EncodeOptions: serialization.EncodeOptions{Indent: "  ", DisableHTMLEscaping: true}}
+	in := map[string]string{"html": "<b>"}
+
+	want, err := s.Marshal(in)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+	got, err := s.MarshalAppend(nil, in)
+	if err != nil {
+		t.Errorf("MarshalAppend() error = %s", err.Error())
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("MarshalAppend() = %q, want %q", got, want)
+	}
+}
+
+func Test_MarshalAppend_Errors(t *testing.T) {
+	dst := []byte("prefix")
+	got, err := serialization.MarshalAppend(dst, newPoolMessage(), "application/unknown")
+	if !errors.Is(err, serialization.ErrUnknownFormat) {
+		t.Errorf("MarshalAppend() error = %v, want ErrUnknownFormat", err)
+	}
+	if !bytes.Equal(got, dst) {
+		t.Errorf("MarshalAppend() = %q, want dst unchanged", got)
+	}
+
+	got, err = serialization.MarshalAppend(dst, make(chan int), serialization.MsgPack)
+	if !errors.Is(err, serialization.ErrUnsupportedType) {
+		t.Errorf("MarshalAppend() error = %v, want ErrUnsupportedType", err)
+	}
+	if !bytes.Equal(got, dst) {
+		t.Errorf("MarshalAppend() = %q, want dst unchanged", got)
+	}
+}
+
+func Test_MarshalAppend_Allocations(t *testing.T) {
+	in := newPoolMessage()
+	buf := make([]byte, 0, 1024)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		var err error
+		if buf, err = serialization.MarshalAppend(buf[:0], in, serialization.MsgPack); err != nil {
+			t.Fatalf("MarshalAppend() error = %s", err.Error())
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("MarshalAppend() allocations = %v, want 0", allocs)
+	}
+}
+
+func benchmarkMarshal(b *testing.B, format serialization.Format) {
+	in := newPoolMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := serialization.Marshal(in, format); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkMarshalAppend(b *testing.B, format serialization.Format) {
+	in := newPoolMessage()
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = serialization.MarshalAppend(buf[:0], in, format); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEncode(b *testing.B, format serialization.Format) {
+	in := newPoolMessage()
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := serialization.Encode(in, &buf, format); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecode(b *testing.B, format serialization.Format) {
+	data, err := serialization.Marshal(newPoolMessage(), format)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var out poolMessage
+		if err := serialization.Decode(bytes.NewReader(data), &out, format); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal_JSON(b *testing.B)          { benchmarkMarshal(b, serialization.JSON) }
+func BenchmarkMarshalAppend_JSON(b *testing.B)    { benchmarkMarshalAppend(b, serialization.JSON) }
+func BenchmarkMarshal_MsgPack(b *testing.B)       { benchmarkMarshal(b, serialization.MsgPack) }
+func BenchmarkMarshalAppend_MsgPack(b *testing.B) { benchmarkMarshalAppend(b, serialization.MsgPack) }
+func BenchmarkMarshal_YAML(b *testing.B)          { benchmarkMarshal(b, serialization.YAML) }
+func BenchmarkMarshal_CBOR(b *testing.B)          { benchmarkMarshal(b, serialization.CBOR) }
+func BenchmarkEncode_MsgPack(b *testing.B)        { benchmarkEncode(b, serialization.MsgPack) }
+func BenchmarkDecode_MsgPack(b *testing.B)        { benchmarkDecode(b, serialization.MsgPack) }
+func BenchmarkDecode_JSON(b *testing.B)           { benchmarkDecode(b, serialization.JSON) }
@@ -0,0 +1,207 @@
+package serialization
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registry maps formats (and their aliases) to serializers.
+type registry struct {
+	serializers map[Format]FormatSerializer
+	aliases     map[Format]Format
+	extensions  map[string]Format
+
+	lock sync.RWMutex
+}
+
+var defaultRegistry = &registry{
+	serializers: map[Format]FormatSerializer{
+		JSON:    &JSONSerializer{},
+		MsgPack: &MsgpackSerializer{},
+		YAML:    &YAMLSerializer{},
+		CBOR:    &CBORSerializer{},
+		TOML:    &TOMLSerializer{},
+		XML:     &XMLSerializer{},
+		Gob:     &GobSerializer{},
+		CSV:     &CSVSerializer{},
+		TSV:     &CSVSerializer{Comma: '\t'},
+
+		CanonicalJSON:    &CanonicalJSONSerializer{},
+		CanonicalMsgPack: &CanonicalMsgpackSerializer{},
+	},
+	aliases: map[Format]Format{
+		"application/x-msgpack": MsgPack,
+		"application/yaml":      YAML,
+		"application/x-yaml":    YAML,
+		"text/yaml":             YAML,
+		"text/xml":              XML,
+	},
+	extensions: map[string]Format{
+		"json":    JSON,
+		"msgpack": MsgPack,
+		"mpk":     MsgPack,
+		"yaml":    YAML,
+		"yml":     YAML,
+		"cbor":    CBOR,
+		"toml":    TOML,
+		"xml":     XML,
+		"gob":     Gob,
+		"csv":     CSV,
+		"tsv":     TSV,
+	},
+}
+
+// normalize lowercases the format and strips any MIME parameters (e.g. "; charset=utf-8").
+func normalize(format Format) Format {
+	f := string(format)
+	if idx := strings.IndexByte(f, ';'); idx >= 0 {
+		f = f[:idx]
+	}
+	return Format(strings.ToLower(strings.TrimSpace(f)))
+}
+
+// Register makes a serializer available for the given format,
+// replacing any serializer previously registered for it.
+func Register(format Format, serializer FormatSerializer) {
+	defaultRegistry.lock.Lock()
+	defer defaultRegistry.lock.Unlock()
+
+	format = normalize(format)
+	delete(defaultRegistry.aliases, format)
+	defaultRegistry.serializers[format] = serializer
+}
+
+// Unregister removes the serializer registered for the given format,
+// along with every alias and extension pointing to it.
+func Unregister(format Format) {
+	defaultRegistry.lock.Lock()
+	defer defaultRegistry.lock.Unlock()
+
+	format = normalize(format)
+	if target, ok := defaultRegistry.aliases[format]; ok {
+		format = target
+	}
+
+	delete(defaultRegistry.serializers, format)
+	for alias, target := range defaultRegistry.aliases {
+		if target == format {
+			delete(defaultRegistry.aliases, alias)
+		}
+	}
+	for ext, target := range defaultRegistry.extensions {
+		if target == format {
+			delete(defaultRegistry.extensions, ext)
+		}
+	}
+}
+
+// RegisterAlias makes alias resolve to an already registered format.
+func RegisterAlias(alias Format, format Format) {
+	defaultRegistry.lock.Lock()
+	defer defaultRegistry.lock.Unlock()
+
+	defaultRegistry.aliases[normalize(alias)] = normalize(format)
+}
+
+// Resolve returns the canonical format for a format or one of its aliases.
+func Resolve(format Format) (Format, bool) {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	return defaultRegistry.resolve(format)
+}
+
+func (r *registry) resolve(format Format) (Format, bool) {
+	format = normalize(format)
+	if target, ok := r.aliases[format]; ok {
+		format = target
+	}
+	if _, ok := r.serializers[format]; ok {
+		return format, true
+	}
+
+	// Compressed variants of registered formats are resolved on the fly.
+	if inner, c, ok := splitCompression(format); ok {
+		if inner, ok = r.resolve(inner); ok {
+			return Compressed(inner, c.Name()), true
+		}
+	}
+	return format, false
+}
+
+// Lookup returns the serializer registered for a format or one of its aliases.
+// Compressed variants such as "application/json+gzip" are wrapped in a CompressedSerializer.
+func Lookup(format Format) (FormatSerializer, bool) {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	canonical, ok := defaultRegistry.resolve(format)
+	if !ok {
+		return nil, false
+	}
+	return defaultRegistry.serializer(canonical), true
+}
+
+// serializer returns the serializer for a canonical format.
+func (r *registry) serializer(canonical Format) FormatSerializer {
+	if serializer, ok := r.serializers[canonical]; ok {
+		return serializer
+	}
+
+	inner, c, _ := splitCompression(canonical)
+	return &CompressedSerializer{Serializer: r.serializer(inner), Compression: c}
+}
+
+// Formats lists the registered formats, sorted, excluding aliases.
+func Formats() []Format {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	formats := make([]Format, 0, len(defaultRegistry.serializers))
+	for format := range defaultRegistry.serializers {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+	return formats
+}
+
+// FieldTags lists the struct tags naming fields in the registered formats, sorted.
+func FieldTags() []string {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, s := range defaultRegistry.serializers {
+		tagger, ok := s.(fieldTagger)
+		if !ok {
+			continue
+		}
+		for _, tag := range tagger.fieldTags() {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Aliases lists the aliases registered for a format, sorted.
+func Aliases(format Format) []Format {
+	defaultRegistry.lock.RLock()
+	defer defaultRegistry.lock.RUnlock()
+
+	format = normalize(format)
+
+	var aliases []Format
+	for alias, target := range defaultRegistry.aliases {
+		if target == format {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i] < aliases[j] })
+	return aliases
+}
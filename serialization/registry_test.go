@@ -0,0 +1,105 @@
+package serialization_test
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type upperSerializer struct{}
+
+func (u *upperSerializer) Marshal(in interface{}) ([]byte, error) {
+	return []byte("UPPER"), nil
+}
+func (u *upperSerializer) Unmarshal(data []byte, out interface{}) error {
+	*(out.(*string)) = string(data)
+	return nil
+}
+func (u *upperSerializer) Encode(in interface{}, w io.Writer) error {
+	_, err := w.Write([]byte("UPPER"))
+	return err
+}
+func (u *upperSerializer) Decode(r io.Reader, out interface{}) error { return nil }
+
+func Test_RegistryBuiltins(t *testing.T) {
+	for _, format := range []serialization.Format{
+		serialization.JSON,
+		serialization.MsgPack,
+		serialization.YAML,
+		"application/x-msgpack",
+		"application/yaml",
+		"Application/JSON; charset=utf-8",
+	} {
+		if _, ok := serialization.Lookup(format); !ok {
+			t.Errorf("Lookup(%q) failed", format)
+		}
+	}
+}
+
+func Test_RegistryFieldTags(t *testing.T) {
+	want := []string{"cbor", "csv", "json", "msg", "toml", "xml", "yaml"}
+	if tags := serialization.FieldTags(); !reflect.DeepEqual(tags, want) {
+		t.Errorf("FieldTags() = %v, want %v", tags, want)
+	}
+}
+
+func Test_RegistryRegisterUnregister(t *testing.T) {
+	const custom serialization.Format = "application/x-upper"
+
+	serialization.Register(custom, &upperSerializer{})
+	serialization.RegisterAlias("text/upper", custom)
+
+	data, err := serialization.Marshal("anything", "text/upper")
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+	if string(data) != "UPPER" {
+		t.Errorf("Marshal() = %s, want UPPER", data)
+	}
+
+	found := false
+	for _, f := range serialization.Formats() {
+		if f == custom {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Formats() does not list %s", custom)
+	}
+
+	if aliases := serialization.Aliases(custom); len(aliases) != 1 || aliases[0] != "text/upper" {
+		t.Errorf("Aliases() = %v", aliases)
+	}
+
+	serialization.Unregister(custom)
+
+	if _, ok := serialization.Lookup(custom); ok {
+		t.Error("format still registered after Unregister()")
+	}
+	if _, ok := serialization.Lookup("text/upper"); ok {
+		t.Error("alias still registered after Unregister()")
+	}
+}
+
+func Test_RegistryConcurrentAccess(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			format := serialization.Format("application/x-concurrent")
+			if i%2 == 0 {
+				serialization.Register(format, &upperSerializer{})
+			} else {
+				serialization.Lookup(format)
+				serialization.Formats()
+			}
+		}(i)
+	}
+	wg.Wait()
+	serialization.Unregister("application/x-concurrent")
+}
@@ -0,0 +1,223 @@
+// Package rpccodec provides net/rpc codecs encoding requests and responses
+// with any registered serialization format.
+//
+// Each message is a header followed by a body, both written as records
+// prefixed by their length (see serialization.NewLengthPrefixedEncoder).
+package rpccodec
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+
+	"github.com/purposed/good/serialization"
+)
+
+// Codec reads and writes header and body pairs over a connection.
+// It is the transport shared by the client and server codecs, and can
+// frame messages of other request/response protocols.
+type Codec struct {
+	conn io.ReadWriteCloser
+
+	writeLock sync.Mutex
+	pending   bytes.Buffer
+	encoder   *serialization.StreamEncoder
+
+	decoder *serialization.StreamDecoder
+}
+
+// NewCodec returns a codec encoding messages in format over conn.
+func NewCodec(conn io.ReadWriteCloser, format serialization.Format) (*Codec, error) {
+	c := &Codec{conn: conn}
+
+	var err error
+	if c.encoder, err = serialization.NewLengthPrefixedEncoder(&c.pending, format); err != nil {
+		return nil, err
+	}
+	if c.decoder, err = serialization.NewLengthPrefixedDecoder(bufio.NewReader(conn), format); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetMaxRecordSize sets the size of the largest header or body accepted when
+// reading, serialization.DefaultMaxRecordSize by default.
+func (c *Codec) SetMaxRecordSize(size int) {
+	c.decoder.SetMaxRecordSize(size)
+}
+
+// WriteMessage writes a header and its body. Nothing is written if either fails to encode.
+func (c *Codec) WriteMessage(header, body interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if err := c.encode(header, body); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// encode encodes a message into the pending buffer, replacing its content.
+func (c *Codec) encode(header, body interface{}) error {
+	c.pending.Reset()
+	if err := c.encoder.Encode(header); err != nil {
+		return err
+	}
+	return c.encoder.Encode(body)
+}
+
+// flush writes the pending message to the connection.
+func (c *Codec) flush() error {
+	_, err := c.conn.Write(c.pending.Bytes())
+	return err
+}
+
+// ReadHeader reads the header of the next message.
+func (c *Codec) ReadHeader(header interface{}) error {
+	return c.decoder.Decode(header)
+}
+
+// ReadBody reads the body of the current message. A nil body discards it.
+func (c *Codec) ReadBody(body interface{}) error {
+	if body == nil {
+		return c.decoder.Skip()
+	}
+	return c.decoder.Decode(body)
+}
+
+// Close closes the connection.
+func (c *Codec) Close() error {
+	return c.conn.Close()
+}
+
+// requestHeader is the header of requests.
+type requestHeader struct {
+	ServiceMethod string `json:"method"`
+	Seq           uint64 `json:"seq"`
+}
+
+// responseHeader is the header of responses.
+type responseHeader struct {
+	ServiceMethod string `json:"method"`
+	Seq           uint64 `json:"seq"`
+	Error         string `json:"error,omitempty"`
+}
+
+type clientCodec struct {
+	*Codec
+}
+
+// NewClientCodec returns a net/rpc client codec encoding messages in format over conn.
+func NewClientCodec(conn io.ReadWriteCloser, format serialization.Format) (rpc.ClientCodec, error) {
+	codec, err := NewCodec(conn, format)
+	if err != nil {
+		return nil, err
+	}
+	return &clientCodec{Codec: codec}, nil
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	return c.WriteMessage(&requestHeader{ServiceMethod: r.ServiceMethod, Seq: r.Seq}, body)
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	var header responseHeader
+	if err := c.ReadHeader(&header); err != nil {
+		return err
+	}
+
+	r.ServiceMethod = header.ServiceMethod
+	r.Seq = header.Seq
+	r.Error = header.Error
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	return c.ReadBody(body)
+}
+
+type serverCodec struct {
+	*Codec
+}
+
+// NewServerCodec returns a net/rpc server codec encoding messages in format over conn.
+func NewServerCodec(conn io.ReadWriteCloser, format serialization.Format) (rpc.ServerCodec, error) {
+	codec, err := NewCodec(conn, format)
+	if err != nil {
+		return nil, err
+	}
+	return &serverCodec{Codec: codec}, nil
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	var header requestHeader
+	if err := c.ReadHeader(&header); err != nil {
+		return err
+	}
+
+	r.ServiceMethod = header.ServiceMethod
+	r.Seq = header.Seq
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	return c.ReadBody(body)
+}
+
+// WriteResponse writes a response. A reply failing to encode is replaced by
+// an error response, so the client is not left waiting.
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	header := &responseHeader{ServiceMethod: r.ServiceMethod, Seq: r.Seq, Error: r.Error}
+	if err := c.encode(header, body); err != nil {
+		header.Error = "rpc: encoding reply: " + err.Error()
+		if err := c.encode(header, nil); err != nil {
+			return err
+		}
+	}
+	return c.flush()
+}
+
+// NewClient returns a net/rpc client encoding messages in format over conn.
+func NewClient(conn io.ReadWriteCloser, format serialization.Format) (*rpc.Client, error) {
+	codec, err := NewClientCodec(conn, format)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClientWithCodec(codec), nil
+}
+
+// Dial connects to a net/rpc server at the given network address.
+func Dial(network, address string, format serialization.Format) (*rpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(conn, format)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// ServeConn serves a single connection with server, or rpc.DefaultServer when nil,
+// blocking until the client hangs up.
+func ServeConn(server *rpc.Server, conn io.ReadWriteCloser, format serialization.Format) error {
+	if server == nil {
+		server = rpc.DefaultServer
+	}
+
+	codec, err := NewServerCodec(conn, format)
+	if err != nil {
+		return err
+	}
+	server.ServeCodec(codec)
+	return nil
+}
@@ -0,0 +1,188 @@
+package rpccodec_test
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+	"github.com/purposed/good/serialization/rpccodec"
+)
+
+type Args struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type Quotient struct {
+	Quo int `json:"quo"`
+	Rem int `json:"rem"`
+}
+
+type Arith struct{}
+
+func (a *Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (a *Arith) Divide(args *Args, quo *Quotient) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	quo.Quo = args.A / args.B
+	quo.Rem = args.A % args.B
+	return nil
+}
+
+// Unencodable replies with a value no format can encode.
+func (a *Arith) Unencodable(args *Args, reply *interface{}) error {
+	*reply = make(chan int)
+	return nil
+}
+
+func newClient(t *testing.T, format serialization.Format) *rpc.Client {
+	server := rpc.NewServer()
+	if err := server.Register(&Arith{}); err != nil {
+		t.Fatalf("Register() error = %s", err.Error())
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go rpccodec.ServeConn(server, serverConn, format)
+
+	client, err := rpccodec.NewClient(clientConn, format)
+	if err != nil {
+		t.Fatalf("NewClient() error = %s", err.Error())
+	}
+	return client
+}
+
+func Test_Codec(t *testing.T) {
+	formats := []serialization.Format{
+		serialization.MsgPack,
+		serialization.JSON,
+		serialization.CBOR,
+		serialization.YAML,
+	}
+
+	for _, format := range formats {
+		t.Run(string(format), func(t *testing.T) {
+			client := newClient(t, format)
+			defer client.Close()
+
+			var product int
+			if err := client.Call("Arith.Multiply", &Args{A: 6, B: 7}, &product); err != nil {
+				t.Errorf("Call() error = %s", err.Error())
+				return
+			}
+			if product != 42 {
+				t.Errorf("Multiply() = %d, want 42", product)
+			}
+
+			// Concurrent calls share the connection.
+			calls := make([]*rpc.Call, 10)
+			for i := range calls {
+				calls[i] = client.Go("Arith.Divide", &Args{A: 100 + i, B: 7}, &Quotient{}, nil)
+			}
+			for i, call := range calls {
+				<-call.Done
+				if call.Error != nil {
+					t.Errorf("Divide() error = %s", call.Error.Error())
+					continue
+				}
+				quo := call.Reply.(*Quotient)
+				if quo.Quo != (100+i)/7 || quo.Rem != (100+i)%7 {
+					t.Errorf("Divide(%d, 7) = %+v", 100+i, quo)
+				}
+			}
+
+			var quo Quotient
+			err := client.Call("Arith.Divide", &Args{A: 1}, &quo)
+			if _, ok := err.(rpc.ServerError); !ok || err.Error() != "divide by zero" {
+				t.Errorf("Call() error = %v, want divide by zero", err)
+			}
+
+			// The connection stays usable after an error response.
+			if err := client.Call("Arith.Multiply", &Args{A: 2, B: 3}, &product); err != nil || product != 6 {
+				t.Errorf("Call() = %d, %v, want 6", product, err)
+			}
+		})
+	}
+}
+
+func Test_Codec_UnencodableReply(t *testing.T) {
+	client := newClient(t, serialization.JSON)
+	defer client.Close()
+
+	var reply interface{}
+	err := client.Call("Arith.Unencodable", &Args{}, &reply)
+	if _, ok := err.(rpc.ServerError); !ok {
+		t.Errorf("Call() error = %v, want a server error", err)
+	}
+
+	var product int
+	if err := client.Call("Arith.Multiply", &Args{A: 2, B: 3}, &product); err != nil || product != 6 {
+		t.Errorf("Call() = %d, %v, want 6", product, err)
+	}
+}
+
+func Test_Dial(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.Register(&Arith{}); err != nil {
+		t.Errorf("Register() error = %s", err.Error())
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Listen() error = %s", err.Error())
+		return
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		rpccodec.ServeConn(server, conn, serialization.MsgPack)
+	}()
+
+	client, err := rpccodec.Dial("tcp", listener.Addr().String(), serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Dial() error = %s", err.Error())
+		return
+	}
+	defer client.Close()
+
+	var product int
+	if err := client.Call("Arith.Multiply", &Args{A: 3, B: 4}, &product); err != nil || product != 12 {
+		t.Errorf("Call() = %d, %v, want 12", product, err)
+	}
+
+	if _, err := rpccodec.Dial("tcp", listener.Addr().String(), "application/unknown"); err == nil {
+		t.Errorf("Dial() expected error for unknown format")
+	}
+}
+
+func Test_Codec_MaxRecordSize(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	client, _ := rpccodec.NewCodec(clientConn, serialization.JSON)
+	server, _ := rpccodec.NewCodec(serverConn, serialization.JSON)
+	server.SetMaxRecordSize(16)
+
+	go client.WriteMessage(&Args{A: 1, B: 2}, &Args{A: 1000000, B: 2000000})
+
+	var header, body Args
+	if err := server.ReadHeader(&header); err != nil {
+		t.Errorf("ReadHeader() error = %s", err.Error())
+		return
+	}
+	if err := server.ReadBody(&body); err == nil {
+		t.Errorf("ReadBody() of an oversized body = nil, want an error")
+	}
+}
@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/purposed/good/internal/structs"
+)
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	durationType       = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	byteSliceType      = reflect.TypeOf([]byte(nil))
+	defaultTags        = []string{"json"}
+	rejectEverything   = &Schema{Not: &Schema{}}
+	nonNegativeMinimum = float64(0)
+)
+
+// Generator generates schemas from Go types.
+type Generator struct {
+	// Tags name struct fields, the first present wins. Defaults to json,
+	// use msg and json to describe msgpack documents.
+	Tags []string
+
+	// DisallowAdditionalProperties rejects properties not declared by structs.
+	DisallowAdditionalProperties bool
+
+	root        reflect.Type
+	definitions map[string]*Schema
+	names       map[reflect.Type]string
+}
+
+// Generate returns the schema of the type of v, using the json tags.
+func Generate(v interface{}) *Schema {
+	return (&Generator{}).Generate(v)
+}
+
+// Generate returns the schema of the type of v.
+// Named struct types other than the root are placed in $defs.
+func (g *Generator) Generate(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	g.root = t
+	g.definitions = make(map[string]*Schema)
+	g.names = make(map[reflect.Type]string)
+
+	var s *Schema
+	if t == nil {
+		s = &Schema{}
+	} else if t.Kind() == reflect.Struct && !isOpaque(t) {
+		s = g.structSchema(t)
+	} else {
+		s = g.typeSchema(t)
+	}
+
+	s.Schema = Draft
+	if len(g.definitions) > 0 {
+		s.Definitions = g.definitions
+	}
+	return s
+}
+
+func (g *Generator) tags() []string {
+	if len(g.Tags) == 0 {
+		return defaultTags
+	}
+	return g.Tags
+}
+
+// isOpaque returns whether t serializes itself rather than field by field.
+func isOpaque(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	return t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+func (g *Generator) typeSchema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: TypeList{TypeString}, Format: FormatDateTime}
+	case t == durationType:
+		return &Schema{Type: TypeList{TypeInteger}}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: TypeList{TypeString}}
+	case t == byteSliceType:
+		return &Schema{Type: TypeList{TypeString}, ContentEncoding: EncodingBase64}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: TypeList{TypeBoolean}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: TypeList{TypeInteger}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		minimum := nonNegativeMinimum
+		return &Schema{Type: TypeList{TypeInteger}, Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: TypeList{TypeNumber}}
+	case reflect.String:
+		return &Schema{Type: TypeList{TypeString}}
+	case reflect.Slice:
+		return &Schema{Type: TypeList{TypeArray, TypeNull}, Items: g.typeSchema(t.Elem())}
+	case reflect.Array:
+		length := t.Len()
+		return &Schema{Type: TypeList{TypeArray}, Items: g.typeSchema(t.Elem()), MinItems: &length, MaxItems: &length}
+	case reflect.Map:
+		return &Schema{Type: TypeList{TypeObject, TypeNull}, AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return nullable(g.typeSchema(t.Elem()))
+	case reflect.Struct:
+		return g.reference(t)
+	}
+	// Interfaces and anything else accept every value.
+	return &Schema{}
+}
+
+func nullable(s *Schema) *Schema {
+	switch {
+	case s.Ref != "":
+		return &Schema{AnyOf: []*Schema{s, {Type: TypeList{TypeNull}}}}
+	case len(s.Type) > 0 && !s.Type.has(TypeNull):
+		s.Type = append(s.Type, TypeNull)
+	}
+	return s
+}
+
+// reference returns a reference to the definition of a struct type, generating it once.
+func (g *Generator) reference(t reflect.Type) *Schema {
+	if t == g.root {
+		return &Schema{Ref: "#"}
+	}
+	if t.Name() == "" {
+		return g.structSchema(t)
+	}
+
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		for i := 2; g.definitions[name] != nil; i++ {
+			name = fmt.Sprintf("%s%d", t.Name(), i)
+		}
+		g.names[t] = name
+
+		// Reserve the name before recursing, so cycles resolve to the reference.
+		g.definitions[name] = &Schema{}
+		*g.definitions[name] = *g.structSchema(t)
+	}
+	return &Schema{Ref: "#/$defs/" + name}
+}
+
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       TypeList{TypeObject},
+		Properties: make(map[string]*Schema),
+	}
+	if g.DisallowAdditionalProperties {
+		s.AdditionalProperties = rejectEverything
+	}
+
+	// Fields are required unless tagged omitempty, and always when tagged `serialization:"required"`.
+	for _, f := range structs.Fields(t, g.tags()) {
+		s.Properties[f.Name] = g.typeSchema(f.Type)
+		if !f.OmitEmpty || f.Required {
+			s.Required = append(s.Required, f.Name)
+		}
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+// Package schema generates JSON Schema documents from Go types and validates
+// generic documents against them.
+package schema
+
+import (
+	"encoding/json"
+)
+
+// Draft is the JSON Schema dialect emitted by the generator.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Type names defined by JSON Schema.
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeString  = "string"
+	TypeArray   = "array"
+	TypeObject  = "object"
+)
+
+// Formats and content encodings emitted by the generator.
+const (
+	FormatDateTime = "date-time"
+	EncodingBase64 = "base64"
+)
+
+// Schema is a JSON Schema document, limited to the keywords used by the generator.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Definitions map[string]*Schema `json:"$defs,omitempty"`
+
+	Type            TypeList `json:"type,omitempty"`
+	Format          string   `json:"format,omitempty"`
+	ContentEncoding string   `json:"contentEncoding,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Minimum *float64 `json:"minimum,omitempty"`
+
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+}
+
+// TypeList is the type keyword, serialized as a string when it holds a single type.
+type TypeList []string
+
+// MarshalJSON implements json.Marshaler.
+func (t TypeList) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *TypeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = TypeList{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (t TypeList) has(name string) bool {
+	for _, n := range t {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/purposed/good/serialization"
+	"github.com/purposed/good/serialization/schema"
+)
+
+type Meta struct {
+	Created time.Time `json:"created"`
+}
+
+type Backend struct {
+	Host     string   `json:"host" msg:"host"`
+	Port     uint16   `json:"port,omitempty" msg:"port"`
+	Fallback *Backend `json:"fallback,omitempty" msg:"fallback,omitempty"`
+}
+
+type Service struct {
+	Meta
+	Name     string            `json:"name" msg:"name"`
+	Weight   float64           `json:"weight,omitempty" msg:"weight"`
+	Labels   map[string]string `json:"labels,omitempty" msg:"labels"`
+	Backends []Backend         `json:"backends" msg:"backends"`
+	Key      []byte            `json:"key,omitempty" serialization:"required" msg:"key"`
+	Ignored  string            `json:"-" msg:"-"`
+}
+
+func Test_Generate(t *testing.T) {
+	data, err := json.Marshal(schema.Generate(&Service{}))
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	expected := `{"$schema":"https://json-schema.org/draft/2020-12/schema",` +
+		`"$defs":{"Backend":{"type":"object","properties":{` +
+		`"fallback":{"anyOf":[{"$ref":"#/$defs/Backend"},{"type":"null"}]},` +
+		`"host":{"type":"string"},` +
+		`"port":{"type":"integer","minimum":0}},"required":["host"]}},` +
+		`"type":"object","properties":{` +
+		`"backends":{"type":["array","null"],"items":{"$ref":"#/$defs/Backend"}},` +
+		`"created":{"type":"string","format":"date-time"},` +
+		`"key":{"type":"string","contentEncoding":"base64"},` +
+		`"labels":{"type":["object","null"],"additionalProperties":{"type":"string"}},` +
+		`"name":{"type":"string"},` +
+		`"weight":{"type":"number"}},` +
+		`"required":["name","backends","key","created"]}`
+	if string(data) != expected {
+		t.Errorf("Generate() =\n%s\nwant\n%s", data, expected)
+	}
+}
+
+func Test_Schema_Validate(t *testing.T) {
+	s := schema.Generate(&Service{})
+
+	type test struct {
+		name     string
+		document string
+		path     string
+	}
+
+	tests := []test{
+		{"Valid", `{"name": "a", "created": "2020-01-01T00:00:00Z", "key": "AQI=", "backends": [{"host": "h", "fallback": {"host": "f"}}], "extra": 1}`, ""},
+		{"MissingRequired", `{"name": "a", "created": "2020-01-01T00:00:00Z", "backends": []}`, "key"},
+		{"WrongType", `{"name": 1, "created": "2020-01-01T00:00:00Z", "key": "", "backends": []}`, "name"},
+		{"NestedMissing", `{"name": "a", "created": "2020-01-01T00:00:00Z", "key": "", "backends": [{"port": 1}]}`, "backends[0].host"},
+		{"Negative", `{"name": "a", "created": "2020-01-01T00:00:00Z", "key": "", "backends": [{"host": "h", "port": -1}]}`, "backends[0].port"},
+		{"BadDate", `{"name": "a", "created": "yesterday", "key": "", "backends": null}`, "created"},
+		{"Recursive", `{"name": "a", "created": "2020-01-01T00:00:00Z", "key": "", "backends": [{"host": "h", "fallback": {"host": 2}}]}`, "backends[0].fallback.host"},
+	}
+
+	for _, tCase := range tests {
+		t.Run(tCase.name, func(t *testing.T) {
+			doc, err := serialization.DecodeGeneric(strings.NewReader(tCase.document), serialization.JSON)
+			if err != nil {
+				t.Errorf("DecodeGeneric() error = %s", err.Error())
+				return
+			}
+
+			err = s.Validate(doc)
+			if tCase.path == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %s", err.Error())
+				}
+				return
+			}
+
+			fieldErr, ok := err.(*serialization.FieldError)
+			if !ok {
+				t.Errorf("Validate() error = %v, want *FieldError", err)
+				return
+			}
+			if fieldErr.Path != tCase.path {
+				t.Errorf("Validate() path = %s, want %s (%s)", fieldErr.Path, tCase.path, fieldErr.Reason)
+			}
+		})
+	}
+}
+
+func Test_Generator_DisallowAdditionalProperties(t *testing.T) {
+	s := (&schema.Generator{DisallowAdditionalProperties: true}).Generate(Backend{})
+
+	doc, err := serialization.DecodeGeneric(strings.NewReader(`{"host": "h", "other": true}`), serialization.JSON)
+	if err != nil {
+		t.Errorf("DecodeGeneric() error = %s", err.Error())
+		return
+	}
+
+	fieldErr, ok := s.Validate(doc).(*serialization.FieldError)
+	if !ok || fieldErr.Path != "other" {
+		t.Errorf("Validate() error = %v, want unknown field other", fieldErr)
+	}
+}
+
+func Test_Unmarshal(t *testing.T) {
+	s := (&schema.Generator{Tags: []string{"msg", "json"}}).Generate(Backend{})
+
+	data, err := serialization.Marshal(map[string]interface{}{"host": "h", "port": 80}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out Backend
+	if err := schema.Unmarshal(data, &out, serialization.MsgPack, s); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	if out.Host != "h" || out.Port != 80 {
+		t.Errorf("Unmarshal() = %+v", out)
+	}
+
+	data, err = serialization.Marshal(map[string]interface{}{"port": 80}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+	if err := schema.Unmarshal(data, &out, serialization.MsgPack, s); err == nil {
+		t.Errorf("Unmarshal() expected error")
+	}
+}
@@ -0,0 +1,249 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/purposed/good/serialization"
+)
+
+// Validate checks a generic document, as returned by serialization.DecodeGeneric,
+// against the schema. Violations are reported as *serialization.FieldError.
+func (s *Schema) Validate(doc interface{}) error {
+	v := validator{root: s}
+	return v.validate(s, doc, "")
+}
+
+// Unmarshal decodes data to a generic document, validates it against the
+// schema and only then loads it into the struct.
+func Unmarshal(data []byte, outStruct interface{}, format serialization.Format, s *Schema) error {
+	doc, err := serialization.DecodeGeneric(bytes.NewReader(data), format)
+	if err != nil {
+		return err
+	}
+	if err := s.Validate(doc); err != nil {
+		return err
+	}
+	return serialization.Unmarshal(data, outStruct, format)
+}
+
+type validator struct {
+	root *Schema
+}
+
+func (v *validator) resolve(ref string) (*Schema, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if name := strings.TrimPrefix(ref, "#/$defs/"); name != ref {
+		if def, ok := v.root.Definitions[name]; ok {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf("unresolvable reference %s", ref)
+}
+
+func fieldError(path, format string, args ...interface{}) error {
+	return &serialization.FieldError{Path: path, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (v *validator) validate(s *Schema, doc interface{}, path string) error {
+	if s.Ref != "" {
+		target, err := v.resolve(s.Ref)
+		if err != nil {
+			return fieldError(path, err.Error())
+		}
+		if err := v.validate(target, doc, path); err != nil {
+			return err
+		}
+	}
+
+	if len(s.AnyOf) > 0 {
+		var firstErr error
+		for _, option := range s.AnyOf {
+			err := v.validate(option, doc, path)
+			if err == nil {
+				firstErr = nil
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return firstErr
+		}
+	}
+
+	if s.Not != nil && v.validate(s.Not, doc, path) == nil {
+		return fieldError(path, "value not allowed")
+	}
+
+	if len(s.Type) > 0 && !matchesType(s.Type, doc) {
+		return fieldError(path, "expected %s, got %s", strings.Join(s.Type, " or "), typeName(doc))
+	}
+
+	switch x := doc.(type) {
+	case string:
+		return v.validateString(s, x, path)
+	case int64:
+		return validateMinimum(s, float64(x), path)
+	case uint64:
+		return validateMinimum(s, float64(x), path)
+	case float64:
+		return validateMinimum(s, x, path)
+	case []interface{}:
+		return v.validateArray(s, x, path)
+	case serialization.OrderedMap:
+		return v.validateObject(s, x, path)
+	}
+	return nil
+}
+
+func (v *validator) validateString(s *Schema, x string, path string) error {
+	if s.Format == FormatDateTime {
+		if _, err := time.Parse(time.RFC3339Nano, x); err != nil {
+			return fieldError(path, "invalid date-time %q", x)
+		}
+	}
+	if s.ContentEncoding == EncodingBase64 {
+		if _, err := base64.StdEncoding.DecodeString(x); err != nil {
+			return fieldError(path, "invalid base64 content")
+		}
+	}
+	return nil
+}
+
+func validateMinimum(s *Schema, x float64, path string) error {
+	if s.Minimum != nil && x < *s.Minimum {
+		return fieldError(path, "%v is less than the minimum %v", x, *s.Minimum)
+	}
+	return nil
+}
+
+func (v *validator) validateArray(s *Schema, items []interface{}, path string) error {
+	if s.MinItems != nil && len(items) < *s.MinItems {
+		return fieldError(path, "expected at least %d items, got %d", *s.MinItems, len(items))
+	}
+	if s.MaxItems != nil && len(items) > *s.MaxItems {
+		return fieldError(path, "expected at most %d items, got %d", *s.MaxItems, len(items))
+	}
+	if s.Items == nil {
+		return nil
+	}
+	for i, item := range items {
+		if err := v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateObject(s *Schema, items serialization.OrderedMap, path string) error {
+	present := make(map[string]bool, len(items))
+
+	for _, item := range items {
+		key := fmt.Sprint(item.Key)
+		present[key] = true
+
+		itemPath := key
+		if path != "" {
+			itemPath = path + "." + key
+		}
+
+		if property, ok := s.Properties[key]; ok {
+			if err := v.validate(property, item.Value, itemPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.AdditionalProperties != nil {
+			if err := v.validate(s.AdditionalProperties, item.Value, itemPath); err != nil {
+				if s.AdditionalProperties.Not != nil {
+					return fieldError(itemPath, "unknown field")
+				}
+				return err
+			}
+		}
+	}
+
+	for _, name := range s.Required {
+		if !present[name] {
+			requiredPath := name
+			if path != "" {
+				requiredPath = path + "." + name
+			}
+			return fieldError(requiredPath, "required field missing")
+		}
+	}
+	return nil
+}
+
+// matchesType returns whether a generic value is an instance of one of the types.
+// Binary blobs and timestamps decoded by msgpack and yaml count as strings.
+func matchesType(types TypeList, doc interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case TypeNull:
+			if doc == nil {
+				return true
+			}
+		case TypeBoolean:
+			if _, ok := doc.(bool); ok {
+				return true
+			}
+		case TypeInteger:
+			switch x := doc.(type) {
+			case int64, uint64:
+				return true
+			case float64:
+				if x == math.Trunc(x) && !math.IsInf(x, 0) {
+					return true
+				}
+			}
+		case TypeNumber:
+			switch doc.(type) {
+			case int64, uint64, float64:
+				return true
+			}
+		case TypeString:
+			switch doc.(type) {
+			case string, []byte, time.Time:
+				return true
+			}
+		case TypeArray:
+			if _, ok := doc.([]interface{}); ok {
+				return true
+			}
+		case TypeObject:
+			if _, ok := doc.(serialization.OrderedMap); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeName(doc interface{}) string {
+	switch doc.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBoolean
+	case int64, uint64:
+		return TypeInteger
+	case float64:
+		return TypeNumber
+	case string, []byte, time.Time:
+		return TypeString
+	case []interface{}:
+		return TypeArray
+	case serialization.OrderedMap:
+		return TypeObject
+	}
+	return fmt.Sprintf("%T", doc)
+}
@@ -0,0 +1,138 @@
+package serialization
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// VerificationError is returned when a signed payload fails verification.
+// It is never returned for errors of the inner format.
+type VerificationError struct {
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return "signature verification failed: " + e.Reason
+}
+
+// Signer signs payloads and verifies their signatures.
+type Signer interface {
+	// Size is the length in bytes of the signatures produced.
+	Size() int
+
+	Sign(data []byte) ([]byte, error)
+	Verify(data []byte, signature []byte) bool
+}
+
+// HMACSigner signs payloads with HMAC-SHA256 using a shared key.
+type HMACSigner struct {
+	Key []byte
+}
+
+// Size returns the length of a HMAC-SHA256 signature.
+func (s *HMACSigner) Size() int {
+	return sha256.Size
+}
+
+// Sign returns the HMAC of data.
+func (s *HMACSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// Verify checks the HMAC of data in constant time.
+func (s *HMACSigner) Verify(data []byte, signature []byte) bool {
+	expected, _ := s.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+// Ed25519Signer signs payloads with an Ed25519 private key and verifies them
+// with the matching public key. A signer without a private key can only verify.
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// Size returns the length of an Ed25519 signature.
+func (s *Ed25519Signer) Size() int {
+	return ed25519.SignatureSize
+}
+
+// Sign signs data with the private key.
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519 signer has no private key")
+	}
+	return ed25519.Sign(s.PrivateKey, data), nil
+}
+
+// Verify checks the signature of data with the public key.
+func (s *Ed25519Signer) Verify(data []byte, signature []byte) bool {
+	publicKey := s.PublicKey
+	if publicKey == nil && len(s.PrivateKey) == ed25519.PrivateKeySize {
+		publicKey = s.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, data, signature)
+}
+
+// SignedSerializer appends a signature to payloads serialized in Format,
+// and verifies it before the payload is decoded.
+type SignedSerializer struct {
+	Format Format
+	Signer Signer
+}
+
+// Marshal serializes inStruct and appends its signature.
+func (m *SignedSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	data, err := Marshal(inStruct, m.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := m.Signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, signature...), nil
+}
+
+// Unmarshal verifies the signature of a raw message, then unmarshals it to a struct.
+func (m *SignedSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	size := m.Signer.Size()
+	if len(rawBytes) < size {
+		return &VerificationError{Reason: "payload shorter than signature"}
+	}
+
+	data, signature := rawBytes[:len(rawBytes)-size], rawBytes[len(rawBytes)-size:]
+	if !m.Signer.Verify(data, signature) {
+		return &VerificationError{Reason: "signature mismatch"}
+	}
+	return Unmarshal(data, outStruct, m.Format)
+}
+
+// Encode signs the struct and writes it to a stream.
+func (m *SignedSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	data, err := m.Marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode reads the whole stream, verifies its signature and unmarshals it.
+func (m *SignedSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(data, outStruct)
+}
@@ -0,0 +1,98 @@
+package serialization_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type signedMessage struct {
+	Amount int    `json:"amount" msg:"amount"`
+	To     string `json:"to" msg:"to"`
+}
+
+func Test_SignedRoundTrip(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Errorf("GenerateKey() error = %s", err.Error())
+		return
+	}
+
+	tests := []struct {
+		name     string
+		signer   serialization.Signer
+		verifier serialization.Signer
+	}{
+		{"hmac", &serialization.HMACSigner{Key: []byte("secret")}, &serialization.HMACSigner{Key: []byte("secret")}},
+		{"ed25519", &serialization.Ed25519Signer{PrivateKey: privateKey}, &serialization.Ed25519Signer{PublicKey: publicKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := signedMessage{Amount: 10, To: "bob"}
+
+			signer := &serialization.SignedSerializer{Format: serialization.JSON, Signer: tt.signer}
+			verifier := &serialization.SignedSerializer{Format: serialization.JSON, Signer: tt.verifier}
+
+			var buf bytes.Buffer
+			if err := signer.Encode(&in, &buf); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+			signed := append([]byte(nil), buf.Bytes()...)
+
+			var out signedMessage
+			if err := verifier.Decode(&buf, &out); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if out != in {
+				t.Errorf("Decode() = %+v, want %+v", out, in)
+			}
+
+			tampered := bytes.Replace(signed, []byte("10"), []byte("99"), 1)
+			err := verifier.Unmarshal(tampered, &out)
+			if _, ok := err.(*serialization.VerificationError); !ok {
+				t.Errorf("Unmarshal() of tampered payload error = %v, want VerificationError", err)
+			}
+		})
+	}
+}
+
+func Test_SignedWrongKey(t *testing.T) {
+	signer := &serialization.SignedSerializer{Format: serialization.MsgPack, Signer: &serialization.HMACSigner{Key: []byte("a")}}
+	verifier := &serialization.SignedSerializer{Format: serialization.MsgPack, Signer: &serialization.HMACSigner{Key: []byte("b")}}
+
+	data, err := signer.Marshal(&signedMessage{Amount: 1})
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out signedMessage
+	if _, ok := verifier.Unmarshal(data, &out).(*serialization.VerificationError); !ok {
+		t.Error("expected a VerificationError")
+	}
+}
+
+func Test_SignedDecodeErrorIsNotVerificationError(t *testing.T) {
+	s := &serialization.SignedSerializer{Format: serialization.JSON, Signer: &serialization.HMACSigner{Key: []byte("k")}}
+
+	data, err := s.Marshal("a string")
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out signedMessage
+	err = s.Unmarshal(data, &out)
+	if err == nil {
+		t.Error("expected a decode error")
+		return
+	}
+	if _, ok := err.(*serialization.VerificationError); ok {
+		t.Error("decode errors should not be reported as verification errors")
+	}
+}
@@ -0,0 +1,382 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRecordSize bounds the size of a single length-prefixed record.
+const maxRecordSize = 1 << 30
+
+// DefaultMaxRecordSize is the size of the largest record accepted by
+// length-prefixed decoders, unless changed with SetMaxRecordSize.
+const DefaultMaxRecordSize = 4 << 20
+
+// RecordEncoder writes consecutive records to a stream.
+type RecordEncoder interface {
+	Encode(inStruct interface{}) error
+}
+
+// RecordDecoder reads consecutive records from a stream.
+type RecordDecoder interface {
+	// Next advances to the next record, returning io.EOF at a clean end of stream.
+	Next() error
+
+	// Decode decodes the current record into outStruct.
+	Decode(outStruct interface{}) error
+}
+
+// Streamer is implemented by serializers able to delimit records in a stream
+// by themselves, keeping state across records.
+type Streamer interface {
+	NewRecordEncoder(w io.Writer) RecordEncoder
+	NewRecordDecoder(r io.Reader) RecordDecoder
+}
+
+// StreamEncoder encodes multiple records to a single stream.
+type StreamEncoder struct {
+	encoder RecordEncoder
+}
+
+// NewStreamEncoder returns an encoder writing records delimited the natural
+// way of the format (newline-delimited JSON, concatenated msgpack,
+// multi-document YAML).
+func NewStreamEncoder(w io.Writer, format Format) (*StreamEncoder, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+
+	streamer, ok := s.(Streamer)
+	if !ok {
+		return nil, fmt.Errorf("format does not support streaming: %s", format)
+	}
+	return &StreamEncoder{encoder: streamer.NewRecordEncoder(w)}, nil
+}
+
+// NewLengthPrefixedEncoder returns an encoder writing each record of any
+// registered format prefixed by its length as a big-endian uint32.
+func NewLengthPrefixedEncoder(w io.Writer, format Format) (*StreamEncoder, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+	return &StreamEncoder{encoder: &lengthPrefixedEncoder{w: w, serializer: s}}, nil
+}
+
+// Encode writes a record to the stream.
+func (e *StreamEncoder) Encode(inStruct interface{}) error {
+	return e.encoder.Encode(inStruct)
+}
+
+// Close flushes any data buffered by the encoder. It does not close the underlying writer.
+func (e *StreamEncoder) Close() error {
+	if closer, ok := e.encoder.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// StreamDecoder decodes multiple records from a single stream.
+//
+// It can be used as an iterator:
+//
+//	for dec.Next() {
+//		if err := dec.Decode(&record); err != nil { ... }
+//	}
+//	if err := dec.Err(); err != nil { ... }
+//
+// or by calling Decode repeatedly until it returns io.EOF.
+type StreamDecoder struct {
+	decoder RecordDecoder
+
+	pending bool
+	err     error
+}
+
+// NewStreamDecoder returns a decoder reading records delimited the natural way of the format.
+func NewStreamDecoder(r io.Reader, format Format) (*StreamDecoder, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+
+	streamer, ok := s.(Streamer)
+	if !ok {
+		return nil, fmt.Errorf("format does not support streaming: %s", format)
+	}
+	return &StreamDecoder{decoder: streamer.NewRecordDecoder(r)}, nil
+}
+
+// NewLengthPrefixedDecoder returns a decoder reading records written by a length-prefixed encoder.
+func NewLengthPrefixedDecoder(r io.Reader, format Format) (*StreamDecoder, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+	return &StreamDecoder{decoder: &lengthPrefixedDecoder{r: r, serializer: s, maxSize: DefaultMaxRecordSize}}, nil
+}
+
+// SetMaxRecordSize sets the size of the largest record accepted by a
+// length-prefixed decoder, up to 1 GiB. It has no effect on other decoders,
+// whose records are delimited by the format.
+func (d *StreamDecoder) SetMaxRecordSize(size int) {
+	if decoder, ok := d.decoder.(*lengthPrefixedDecoder); ok {
+		if size > maxRecordSize {
+			size = maxRecordSize
+		}
+		decoder.maxSize = size
+	}
+}
+
+// Next advances to the next record, returning false at the end of the
+// stream or on error. Err distinguishes both cases.
+func (d *StreamDecoder) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	if d.pending {
+		return true
+	}
+
+	if err := d.decoder.Next(); err != nil {
+		d.err = err
+		return false
+	}
+	d.pending = true
+	return true
+}
+
+// Decode decodes the current record into outStruct, advancing to the next
+// record first if Next wasn't called. It returns io.EOF at a clean end of stream.
+func (d *StreamDecoder) Decode(outStruct interface{}) error {
+	if !d.Next() {
+		return d.err
+	}
+	d.pending = false
+	return d.decoder.Decode(outStruct)
+}
+
+// Skip discards the current record, advancing to the next record first if
+// Next wasn't called. It returns io.EOF at a clean end of stream.
+func (d *StreamDecoder) Skip() error {
+	if !d.Next() {
+		return d.err
+	}
+	d.pending = false
+	return nil
+}
+
+// Err returns the error that stopped the iteration, or nil at a clean end of stream.
+func (d *StreamDecoder) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+type lengthPrefixedEncoder struct {
+	w          io.Writer
+	serializer FormatSerializer
+}
+
+func (e *lengthPrefixedEncoder) Encode(inStruct interface{}) error {
+	data, err := e.serializer.Marshal(inStruct)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("record too large: %d bytes", len(data))
+	}
+
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := e.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+type lengthPrefixedDecoder struct {
+	r          io.Reader
+	serializer FormatSerializer
+	maxSize    int
+
+	record bytes.Buffer
+}
+
+func (d *lengthPrefixedDecoder) Next() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(d.r, prefix[:]); err != nil {
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[:])
+	if uint64(size) > uint64(d.maxSize) {
+		return fmt.Errorf("record too large: %d bytes", size)
+	}
+
+	// The buffer grows as data arrives, rather than trusting the prefix for its allocation.
+	d.record.Reset()
+	if _, err := io.CopyN(&d.record, d.r, int64(size)); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *lengthPrefixedDecoder) Decode(outStruct interface{}) error {
+	return d.serializer.Unmarshal(d.record.Bytes(), outStruct)
+}
+
+// NewRecordEncoder returns an encoder writing newline-delimited JSON.
+// Indentation is ignored so each record stays on a single line.
+func (m *JSONSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(!m.EncodeOptions.DisableHTMLEscaping)
+	return encoder
+}
+
+// NewRecordDecoder returns a decoder reading consecutive JSON values.
+// Records are decoded with the options of the serializer.
+func (m *JSONSerializer) NewRecordDecoder(r io.Reader) RecordDecoder {
+	return &jsonRecordDecoder{decoder: json.NewDecoder(r), serializer: m}
+}
+
+type jsonRecordDecoder struct {
+	decoder    *json.Decoder
+	serializer *JSONSerializer
+	record     json.RawMessage
+}
+
+func (d *jsonRecordDecoder) Next() error {
+	d.record = d.record[:0]
+	return decodeError(JSON, d.decoder.Decode(&d.record), -1)
+}
+
+func (d *jsonRecordDecoder) Decode(outStruct interface{}) error {
+	return d.serializer.Unmarshal(d.record, outStruct)
+}
+
+// NewRecordEncoder returns an encoder writing concatenated msgpack objects.
+func (m *MsgpackSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	return &msgpackRecordEncoder{w: w, encoder: msgpackEncoder{opts: m.EncodeOptions}}
+}
+
+// NewRecordDecoder returns a decoder reading concatenated msgpack objects.
+func (m *MsgpackSerializer) NewRecordDecoder(r io.Reader) RecordDecoder {
+	return &msgpackRecordDecoder{reader: msgp.NewReader(r), serializer: m}
+}
+
+type msgpackRecordEncoder struct {
+	w       io.Writer
+	encoder msgpackEncoder
+
+	buf []byte
+}
+
+func (e *msgpackRecordEncoder) Encode(inStruct interface{}) error {
+	var err error
+	if mrsh, ok := inStruct.(msgp.Marshaler); ok {
+		e.buf, err = mrsh.MarshalMsg(e.buf[:0])
+	} else {
+		e.buf, err = e.encoder.append(e.buf[:0], reflect.ValueOf(inStruct))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+type msgpackRecordDecoder struct {
+	reader     *msgp.Reader
+	serializer *MsgpackSerializer
+
+	record bytes.Buffer
+}
+
+func (d *msgpackRecordDecoder) Next() error {
+	if _, err := d.reader.NextType(); err != nil {
+		return decodeError(MsgPack, err, -1)
+	}
+
+	d.record.Reset()
+	if _, err := d.reader.CopyNext(&d.record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return decodeError(MsgPack, err, -1)
+	}
+	return nil
+}
+
+func (d *msgpackRecordDecoder) Decode(outStruct interface{}) error {
+	return d.serializer.Unmarshal(d.record.Bytes(), outStruct)
+}
+
+// NewRecordEncoder returns an encoder writing a multi-document YAML stream.
+func (m *YAMLSerializer) NewRecordEncoder(w io.Writer) RecordEncoder {
+	encoder := yaml.NewEncoder(w)
+	if m.EncodeOptions.Indent != "" {
+		encoder.SetIndent(len(m.EncodeOptions.Indent))
+	}
+	return &yamlRecordEncoder{encoder: encoder}
+}
+
+type yamlRecordEncoder struct {
+	encoder *yaml.Encoder
+}
+
+func (e *yamlRecordEncoder) Encode(inStruct interface{}) error {
+	return encodeYAML(func() error { return e.encoder.Encode(inStruct) })
+}
+
+// Close ends the yaml stream.
+func (e *yamlRecordEncoder) Close() error {
+	return e.encoder.Close()
+}
+
+// NewRecordDecoder returns a decoder reading the documents of a YAML stream.
+func (m *YAMLSerializer) NewRecordDecoder(r io.Reader) RecordDecoder {
+	return &yamlRecordDecoder{decoder: yaml.NewDecoder(r), serializer: m}
+}
+
+type yamlRecordDecoder struct {
+	decoder    *yaml.Decoder
+	serializer *YAMLSerializer
+	record     yaml.Node
+}
+
+func (d *yamlRecordDecoder) Next() error {
+	d.record = yaml.Node{}
+	return decodeError(YAML, d.decoder.Decode(&d.record), -1)
+}
+
+func (d *yamlRecordDecoder) Decode(outStruct interface{}) error {
+	if d.record.Kind == 0 {
+		return errors.New("no current yaml document")
+	}
+	if !d.serializer.DecodeOptions.enabled() {
+		return decodeError(YAML, d.record.Decode(outStruct), -1)
+	}
+
+	// The checks run on raw documents, the record is encoded back.
+	data, err := yaml.Marshal(&d.record)
+	if err != nil {
+		return err
+	}
+	return d.serializer.Unmarshal(data, outStruct)
+}
@@ -0,0 +1,193 @@
+package serialization_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type streamRecord struct {
+	Seq  int    `json:"seq" msg:"seq" yaml:"seq"`
+	Body string `json:"body" msg:"body" yaml:"body"`
+}
+
+func Test_StreamRoundTrip(t *testing.T) {
+	type codec struct {
+		name       string
+		newEncoder func(io.Writer, serialization.Format) (*serialization.StreamEncoder, error)
+		newDecoder func(io.Reader, serialization.Format) (*serialization.StreamDecoder, error)
+	}
+	codecs := []codec{
+		{"delimited", serialization.NewStreamEncoder, serialization.NewStreamDecoder},
+		{"length prefixed", serialization.NewLengthPrefixedEncoder, serialization.NewLengthPrefixedDecoder},
+	}
+
+	for _, c := range codecs {
+		for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML} {
+			t.Run(c.name+"/"+string(format), func(t *testing.T) {
+				var buf bytes.Buffer
+
+				enc, err := c.newEncoder(&buf, format)
+				if err != nil {
+					t.Errorf("encoder error = %s", err.Error())
+					return
+				}
+				for i := 0; i < 100; i++ {
+					if err := enc.Encode(&streamRecord{Seq: i, Body: "payload"}); err != nil {
+						t.Errorf("Encode() error = %s", err.Error())
+						return
+					}
+				}
+				if err := enc.Close(); err != nil {
+					t.Errorf("Close() error = %s", err.Error())
+					return
+				}
+
+				dec, err := c.newDecoder(&buf, format)
+				if err != nil {
+					t.Errorf("decoder error = %s", err.Error())
+					return
+				}
+
+				count := 0
+				for dec.Next() {
+					var record streamRecord
+					if err := dec.Decode(&record); err != nil {
+						t.Errorf("Decode() error = %s", err.Error())
+						return
+					}
+					if record.Seq != count {
+						t.Errorf("record %d has seq %d", count, record.Seq)
+					}
+					count++
+				}
+				if err := dec.Err(); err != nil {
+					t.Errorf("Err() = %s", err.Error())
+				}
+				if count != 100 {
+					t.Errorf("decoded %d records, want 100", count)
+				}
+
+				var record streamRecord
+				if err := dec.Decode(&record); err != io.EOF {
+					t.Errorf("Decode() at end of stream = %v, want io.EOF", err)
+				}
+			})
+		}
+	}
+}
+
+func Test_StreamTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := serialization.NewStreamEncoder(&buf, serialization.MsgPack)
+	if err := enc.Encode(&streamRecord{Seq: 1, Body: "payload"}); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+
+	truncated := buf.Bytes()[:buf.Len()-3]
+	dec, _ := serialization.NewStreamDecoder(bytes.NewReader(truncated), serialization.MsgPack)
+
+	var record streamRecord
+	if err := dec.Decode(&record); err == nil || err == io.EOF {
+		t.Errorf("Decode() of a truncated record = %v, want an error", err)
+	}
+}
+
+func Test_StreamSkip(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := serialization.NewLengthPrefixedEncoder(&buf, serialization.JSON)
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(&streamRecord{Seq: i}); err != nil {
+			t.Errorf("Encode() error = %s", err.Error())
+			return
+		}
+	}
+
+	dec, _ := serialization.NewLengthPrefixedDecoder(&buf, serialization.JSON)
+	if err := dec.Skip(); err != nil {
+		t.Errorf("Skip() error = %s", err.Error())
+		return
+	}
+	if !dec.Next() {
+		t.Errorf("Next() = false, want true")
+		return
+	}
+	if err := dec.Skip(); err != nil {
+		t.Errorf("Skip() error = %s", err.Error())
+		return
+	}
+
+	var record streamRecord
+	if err := dec.Decode(&record); err != nil || record.Seq != 2 {
+		t.Errorf("Decode() = %v, %v, want seq 2", record, err)
+	}
+	if err := dec.Skip(); err != io.EOF {
+		t.Errorf("Skip() at end of stream = %v, want io.EOF", err)
+	}
+}
+
+func Test_StreamRecordSize(t *testing.T) {
+	// A prefix announcing a 1 GiB record, followed by nothing.
+	dec, _ := serialization.NewLengthPrefixedDecoder(bytes.NewReader([]byte{0x3f, 0xff, 0xff, 0xff}), serialization.JSON)
+	var record streamRecord
+	if err := dec.Decode(&record); err == nil || err == io.EOF {
+		t.Errorf("Decode() of an oversized record = %v, want an error", err)
+	}
+
+	var buf bytes.Buffer
+	enc, _ := serialization.NewLengthPrefixedEncoder(&buf, serialization.JSON)
+	if err := enc.Encode(&streamRecord{Seq: 1, Body: "payload"}); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+
+	dec, _ = serialization.NewLengthPrefixedDecoder(bytes.NewReader(buf.Bytes()), serialization.JSON)
+	dec.SetMaxRecordSize(8)
+	if err := dec.Decode(&record); err == nil || err == io.EOF {
+		t.Errorf("Decode() with a small record size = %v, want an error", err)
+	}
+
+	dec, _ = serialization.NewLengthPrefixedDecoder(bytes.NewReader(buf.Bytes()), serialization.JSON)
+	dec.SetMaxRecordSize(buf.Len())
+	if err := dec.Decode(&record); err != nil || record.Body != "payload" {
+		t.Errorf("Decode() = %v, %v, want the record", record, err)
+	}
+}
+
+func Test_StreamDecodeOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		s    serialization.Streamer
+		data string
+	}{
+		{"json", &serialization.JSONSerializer{DecodeOptions: serialization.StrictDecoding}, `{"seq": 1} {"seq": 2, "extra": true}`},
+		{"yaml", &serialization.YAMLSerializer{DecodeOptions: serialization.StrictDecoding}, "seq: 1\n---\nseq: 2\nextra: true\n"},
+		{"yaml limits", &serialization.YAMLSerializer{DecodeOptions: serialization.DecodeOptions{MaxStringLength: 4}}, "body: abc\n---\nbody: abcdef\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := tt.s.NewRecordDecoder(bytes.NewReader([]byte(tt.data)))
+
+			var record streamRecord
+			if err := dec.Next(); err != nil {
+				t.Errorf("Next() error = %s", err.Error())
+				return
+			}
+			if err := dec.Decode(&record); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if err := dec.Next(); err != nil {
+				t.Errorf("Next() error = %s", err.Error())
+				return
+			}
+			if err := dec.Decode(&record); err == nil {
+				t.Errorf("Decode() of an invalid record = nil, want an error")
+			}
+		})
+	}
+}
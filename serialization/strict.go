@@ -0,0 +1,420 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeOptions configures the checks performed when decoding.
+// The zero value performs no additional checks.
+type DecodeOptions struct {
+	// DisallowUnknownFields rejects object keys matching no field of the target struct.
+	DisallowUnknownFields bool
+
+	// DisallowDuplicateKeys rejects objects defining the same key twice.
+	DisallowDuplicateKeys bool
+
+	// DisallowTrailingData rejects anything following the first value,
+	// including additional YAML documents. TOML documents are a single table,
+	// so never have trailing data. Serializers which neither delimit records
+	// nor check trailing data themselves fail with this option.
+	DisallowTrailingData bool
+
+	// CheckRequired rejects objects missing a field tagged `serialization:"required"`.
+	CheckRequired bool
+
+	// MaxBytes rejects documents larger than this many bytes,
+	// checked after decompression for compressed formats.
+	MaxBytes int64
+
+	// MaxDepth rejects documents nesting arrays and objects deeper than this.
+	MaxDepth int
+
+	// MaxCollectionLength rejects arrays and objects with more items than this.
+	MaxCollectionLength int
+
+	// MaxStringLength rejects strings, keys and binary blobs longer than this many bytes.
+	MaxStringLength int
+}
+
+// StrictDecoding enables every decoding check. It sets no limit.
+var StrictDecoding = DecodeOptions{
+	DisallowUnknownFields: true,
+	DisallowDuplicateKeys: true,
+	DisallowTrailingData:  true,
+	CheckRequired:         true,
+}
+
+func (o DecodeOptions) enabled() bool {
+	return o != DecodeOptions{}
+}
+
+// FieldError reports a problem with a specific field of a decoded document.
+type FieldError struct {
+	Path   string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// fieldTagger is implemented by serializers to tell which struct tags name their fields.
+type fieldTagger interface {
+	fieldTags() []string
+}
+
+func (m *JSONSerializer) fieldTags() []string    { return []string{"json"} }
+func (m *MsgpackSerializer) fieldTags() []string { return msgpackTags }
+func (m *YAMLSerializer) fieldTags() []string    { return []string{"yaml"} }
+func (m *CBORSerializer) fieldTags() []string    { return []string{"cbor", "json"} }
+func (m *TOMLSerializer) fieldTags() []string    { return []string{"toml"} }
+func (m *XMLSerializer) fieldTags() []string     { return []string{"xml"} }
+func (m *CSVSerializer) fieldTags() []string     { return csvTags }
+
+// caseFolder is implemented by serializers whose decoders match field names
+// case-insensitively when no exact match exists. Yaml only matches exactly.
+type caseFolder interface {
+	foldsFieldNames()
+}
+
+func (m *JSONSerializer) foldsFieldNames()    {}
+func (m *MsgpackSerializer) foldsFieldNames() {}
+func (m *CBORSerializer) foldsFieldNames()    {}
+func (m *TOMLSerializer) foldsFieldNames()    {}
+
+// UnmarshalWithOptions loads the data in the correct format to the struct,
+// performing the checks enabled in opts.
+func UnmarshalWithOptions(data []byte, outStruct interface{}, format Format, opts DecodeOptions) error {
+	s, ok := Lookup(format)
+	if !ok {
+		return unknownFormat(format)
+	}
+
+	if checker, ok := s.(selfChecker); ok {
+		return checker.unmarshalWithOptions(data, outStruct, opts)
+	}
+	if err := checkDocument(s, data, outStruct, opts); err != nil {
+		return err
+	}
+	return s.Unmarshal(data, outStruct)
+}
+
+// DecodeWithOptions decodes body from the reader into the struct,
+// performing the checks enabled in opts. When checks are enabled,
+// the whole stream is read before decoding.
+func DecodeWithOptions(r io.Reader, outStruct interface{}, format Format, opts DecodeOptions) error {
+	if !opts.enabled() {
+		return Decode(r, outStruct, format)
+	}
+
+	data, err := readDocument(r, opts)
+	if err != nil {
+		return err
+	}
+	return UnmarshalWithOptions(data, outStruct, format, opts)
+}
+
+// selfChecker is implemented by serializers performing the checks of
+// DecodeOptions while decoding, rather than on the raw document.
+type selfChecker interface {
+	unmarshalWithOptions(data []byte, outStruct interface{}, opts DecodeOptions) error
+}
+
+// decodeWithOptions reads the whole stream when checks are enabled, then
+// unmarshals it with the serializer. It returns false when no check is enabled.
+func decodeWithOptions(s FormatSerializer, r io.Reader, outStruct interface{}, opts DecodeOptions) (bool, error) {
+	if !opts.enabled() {
+		return false, nil
+	}
+
+	data, err := readDocument(r, opts)
+	if err != nil {
+		return true, err
+	}
+	return true, s.Unmarshal(data, outStruct)
+}
+
+// checkDocument performs the checks enabled in opts on a raw document, against the target type.
+func checkDocument(s FormatSerializer, data []byte, outStruct interface{}, opts DecodeOptions) error {
+	if !opts.enabled() {
+		return nil
+	}
+
+	if err := checkLimits(s, data, opts); err != nil {
+		return err
+	}
+
+	if opts.DisallowTrailingData {
+		if err := checkTrailingData(s, data); err != nil {
+			return err
+		}
+	}
+
+	if !opts.DisallowUnknownFields && !opts.DisallowDuplicateKeys && !opts.CheckRequired {
+		return nil
+	}
+
+	// Yaml aliases are expanded by yamlNodeToGeneric, which rejects cycles and excessive aliasing.
+	doc, err := decodeGeneric(s, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	tags := []string{"json"}
+	if tagger, ok := s.(fieldTagger); ok {
+		tags = tagger.fieldTags()
+	}
+
+	_, fold := s.(caseFolder)
+	checker := &documentChecker{opts: opts, tags: tags, fold: fold}
+	return checker.check(doc, reflect.TypeOf(outStruct), "")
+}
+
+// trailingChecker is implemented by serializers checking that a raw document
+// holds a single value, when they can't delimit records in a stream.
+type trailingChecker interface {
+	checkTrailingData(data []byte) error
+}
+
+// trailingDataError reports data following the first value of a document.
+func trailingDataError() error {
+	return &FieldError{Reason: "trailing data after the first value"}
+}
+
+// checkTrailingData ensures the document holds a single value.
+func checkTrailingData(s FormatSerializer, data []byte) error {
+	if checker, ok := s.(trailingChecker); ok {
+		return checker.checkTrailingData(data)
+	}
+
+	streamer, ok := s.(Streamer)
+	if !ok {
+		return fmt.Errorf("trailing data cannot be checked with %T", s)
+	}
+
+	decoder := streamer.NewRecordDecoder(bytes.NewReader(data))
+	if err := decoder.Next(); err != nil {
+		return err
+	}
+	if err := decoder.Next(); err != io.EOF {
+		return trailingDataError()
+	}
+	return nil
+}
+
+func (m *CBORSerializer) checkTrailingData(data []byte) error {
+	var raw cbor.RawMessage
+	rest, err := cbor.UnmarshalFirst(data, &raw)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return trailingDataError()
+	}
+	return nil
+}
+
+// checkTrailingData accepts only comments and processing instructions after the root element.
+func (m *XMLSerializer) checkTrailingData(data []byte) error {
+	roots, err := countXMLRoots(data)
+	if err != nil {
+		return err
+	}
+	if roots > 1 {
+		return trailingDataError()
+	}
+	return nil
+}
+
+// countXMLRoots returns the number of top-level elements of a document,
+// text outside of the root element counting as an element.
+func countXMLRoots(data []byte) (int, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	roots := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return roots, nil
+		}
+		if err != nil {
+			return roots, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			roots++
+			if err := decoder.Skip(); err != nil {
+				return roots, err
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				roots++
+			}
+		}
+	}
+}
+
+// checkTrailingData discards the first value, the stream must end after it.
+func (m *GobSerializer) checkTrailingData(data []byte) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.DecodeValue(reflect.Value{}); err != nil {
+		return err
+	}
+	if err := decoder.DecodeValue(reflect.Value{}); err != io.EOF {
+		return trailingDataError()
+	}
+	return nil
+}
+
+// checkTrailingData accepts every document, which is a single table.
+func (m *TOMLSerializer) checkTrailingData(data []byte) error {
+	return nil
+}
+
+// checkTrailingData checks the decompressed payload with the wrapped serializer.
+func (m *CompressedSerializer) checkTrailingData(data []byte) error {
+	c, ok := detectCompression(data)
+	if !ok {
+		return checkTrailingData(m.Serializer, data)
+	}
+
+	reader, err := c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if data, err = ioutil.ReadAll(reader); err != nil {
+		return err
+	}
+	return checkTrailingData(m.Serializer, data)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	msgpUnmarshalerType = reflect.TypeOf((*msgp.Unmarshaler)(nil)).Elem()
+)
+
+// hasCustomDecoding returns whether values of the type decode themselves,
+// in which case their content is not checked.
+func hasCustomDecoding(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	for _, iface := range []reflect.Type{jsonUnmarshalerType, yamlUnmarshalerType, textUnmarshalerType, msgpUnmarshalerType} {
+		if ptr.Implements(iface) {
+			return true
+		}
+	}
+	return t == timeType
+}
+
+type documentChecker struct {
+	opts DecodeOptions
+	tags []string
+	fold bool
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// check walks a generic document along with the type it is decoded into.
+// A nil type only checks for duplicate keys.
+func (c *documentChecker) check(doc interface{}, t reflect.Type, path string) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && (t.Kind() == reflect.Interface || hasCustomDecoding(t)) {
+		t = nil
+	}
+
+	switch x := doc.(type) {
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i, item := range x {
+			if err := c.check(item, elem, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case OrderedMap:
+		if c.opts.DisallowDuplicateKeys {
+			seen := make(map[string]bool, len(x))
+			for _, item := range x {
+				key := fmt.Sprint(item.Key)
+				if seen[key] {
+					return &FieldError{Path: joinPath(path, key), Reason: "duplicate key"}
+				}
+				seen[key] = true
+			}
+		}
+
+		if t != nil && t.Kind() == reflect.Struct {
+			return c.checkStruct(x, t, path)
+		}
+
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Map {
+			elem = t.Elem()
+		}
+		for _, item := range x {
+			if err := c.check(item.Value, elem, joinPath(path, fmt.Sprint(item.Key))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *documentChecker) checkStruct(doc OrderedMap, t reflect.Type, path string) error {
+	fields := cachedFields(t, c.tags...)
+	present := make(map[string]bool, len(doc))
+
+	for _, item := range doc {
+		key := fmt.Sprint(item.Key)
+
+		f, ok := lookupField(fields, key, c.fold)
+		if !ok {
+			if c.opts.DisallowUnknownFields {
+				return &FieldError{Path: joinPath(path, key), Reason: "unknown field"}
+			}
+			continue
+		}
+		present[f.Name] = true
+
+		if err := c.check(item.Value, f.Type, joinPath(path, key)); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.CheckRequired {
+		for _, f := range fields {
+			if f.Required && !present[f.Name] {
+				return &FieldError{Path: joinPath(path, f.Name), Reason: "missing required field"}
+			}
+		}
+	}
+	return nil
+}
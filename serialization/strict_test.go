@@ -0,0 +1,109 @@
+package serialization_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type strictBackend struct {
+	Host string `json:"host" yaml:"host" msg:"host" serialization:"required"`
+	Port int    `json:"port" yaml:"port" msg:"port"`
+}
+
+type strictConfig struct {
+	Name     string          `json:"name" yaml:"name" msg:"name" serialization:"required"`
+	Backends []strictBackend `json:"backends" yaml:"backends" msg:"backends"`
+}
+
+func Test_StrictDecoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   serialization.Format
+		data     string
+		wantPath string
+	}{
+		{"json valid", serialization.JSON, `{"name": "a", "backends": [{"host": "h"}]}`, ""},
+		{"json unknown field", serialization.JSON, `{"name": "a", "backends": [{"host": "h", "prot": 1}]}`, "backends[0].prot"},
+		{"json duplicate key", serialization.JSON, `{"name": "a", "name": "b"}`, "name"},
+		{"json missing required", serialization.JSON, `{"backends": []}`, "name"},
+		{"json nested required", serialization.JSON, `{"name": "a", "backends": [{"port": 1}]}`, "backends[0].host"},
+		{"json case-insensitive field", serialization.JSON, `{"NAME": "a"}`, ""},
+		{"json null required", serialization.JSON, `{"name": null}`, ""},
+		{"json trailing data", serialization.JSON, `{"name": "a"} {"name": "b"}`, "-"},
+		{"yaml valid", serialization.YAML, "name: a\nbackends:\n  - host: h\n", ""},
+		{"yaml unknown field", serialization.YAML, "name: a\nbackend: []\n", "backend"},
+		{"yaml case-sensitive field", serialization.YAML, "NAME: a\n", "NAME"},
+		{"yaml null required", serialization.YAML, "name: ~\n", ""},
+		{"yaml trailing document", serialization.YAML, "name: a\n---\nname: b\n", "-"},
+		{"yaml alias", serialization.YAML, "name: &n a\nbackends:\n  - host: *n\n", ""},
+		{"yaml recursive alias", serialization.YAML, "name: a\nbackends: &x [*x]\n", "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strictConfig
+			err := serialization.UnmarshalWithOptions([]byte(tt.data), &out, tt.format, serialization.StrictDecoding)
+
+			switch tt.wantPath {
+			case "":
+				if err != nil {
+					t.Errorf("UnmarshalWithOptions() error = %s", err.Error())
+				}
+			case "-":
+				if err == nil {
+					t.Error("UnmarshalWithOptions() expected an error")
+				}
+			default:
+				fieldErr, ok := err.(*serialization.FieldError)
+				if !ok {
+					t.Errorf("UnmarshalWithOptions() error = %v, want FieldError", err)
+					return
+				}
+				if fieldErr.Path != tt.wantPath {
+					t.Errorf("error path = %s, want %s", fieldErr.Path, tt.wantPath)
+				}
+			}
+		})
+	}
+}
+
+func Test_StrictMsgpack(t *testing.T) {
+	data, err := serialization.Marshal(map[string]interface{}{"name": "a", "extra": true}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	s := &serialization.MsgpackSerializer{DecodeOptions: serialization.StrictDecoding}
+
+	var out strictConfig
+	fieldErr, ok := s.Unmarshal(data, &out).(*serialization.FieldError)
+	if !ok || fieldErr.Path != "extra" {
+		t.Errorf("Unmarshal() error = %v, want unknown field extra", fieldErr)
+	}
+
+	if err := s.Unmarshal(append(data, 0x01), &out); err == nil {
+		t.Error("expected an error for trailing data")
+	}
+}
+
+func Test_LenientByDefault(t *testing.T) {
+	var out strictConfig
+	if err := serialization.Unmarshal([]byte(`{"unknown": 1}`), &out, serialization.JSON); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+	}
+}
+
+func Test_StrictYAMLAliasExpansion(t *testing.T) {
+	doc := "a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for c := 'b'; c <= 'i'; c++ {
+		doc += fmt.Sprintf("%c: &%c [*%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c]\n", c, c, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1)
+	}
+
+	var out map[string]interface{}
+	opts := serialization.DecodeOptions{DisallowUnknownFields: true}
+	if err := serialization.UnmarshalWithOptions([]byte(doc), &out, serialization.YAML, opts); err == nil {
+		t.Error("UnmarshalWithOptions() expected an error")
+	}
+}
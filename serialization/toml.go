@@ -0,0 +1,58 @@
+package serialization
+
+import (
+	"io"
+
+	"github.com/pelletier/go-toml"
+)
+
+// TOMLSerializer serializes messages to toml. Documents are tables, so only
+// structs and maps can be serialized at the top level. Times are written
+// with second precision.
+type TOMLSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
+}
+
+// Marshal marshals inStruct to toml.
+func (m *TOMLSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to toml using the given options.
+func (m *TOMLSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	return marshalPooled(func(w io.Writer) error {
+		return m.EncodeWithOptions(inStruct, w, opts)
+	})
+}
+
+// Unmarshal unmarshals a raw toml message to a struct.
+func (m *TOMLSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(TOML, err, -1)
+	}
+	return decodeError(TOML, toml.Unmarshal(rawBytes, outStruct), -1)
+}
+
+// Encode marshals the struct to a stream.
+func (m *TOMLSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+// Indent sets the indentation of nested tables.
+func (m *TOMLSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	encoder := toml.NewEncoder(w)
+	if opts.Indent != "" {
+		encoder.Indentation(opts.Indent)
+	}
+	return encodeError(encoder.Encode(inStruct))
+}
+
+// Decode unmarshals the struct from a stream.
+func (m *TOMLSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+	return decodeError(TOML, toml.NewDecoder(r).Decode(outStruct), -1)
+}
@@ -0,0 +1,734 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+	"gopkg.in/yaml.v3"
+)
+
+// MapItem is a key/value pair of an OrderedMap.
+type MapItem struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// OrderedMap is a map preserving the order of its keys.
+type OrderedMap []MapItem
+
+// Get returns the value associated with a key.
+func (m OrderedMap) Get(key interface{}) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GenericSerializer is implemented by serializers able to decode documents
+// to, and encode documents from, the generic representation used by Transcode.
+//
+// The generic representation is made of nil, bool, int64, uint64, float64,
+// string, []byte, time.Time, []interface{} and OrderedMap values.
+type GenericSerializer interface {
+	DecodeGeneric(r io.Reader) (interface{}, error)
+	EncodeGeneric(v interface{}, w io.Writer) error
+}
+
+// DecodeGeneric decodes a document into the generic representation, without a target struct.
+func DecodeGeneric(r io.Reader, format Format) (interface{}, error) {
+	s, ok := Lookup(format)
+	if !ok {
+		return nil, unknownFormat(format)
+	}
+	return decodeGeneric(s, r)
+}
+
+// EncodeGeneric encodes a document in the generic representation.
+func EncodeGeneric(v interface{}, w io.Writer, format Format) error {
+	s, ok := Lookup(format)
+	if !ok {
+		return unknownFormat(format)
+	}
+	return encodeGeneric(s, v, w)
+}
+
+// Transcode converts a document between two registered formats, going through
+// the generic representation so integers and floats, binary blobs and key
+// order are preserved wherever both formats can express them.
+func Transcode(r io.Reader, from Format, w io.Writer, to Format) error {
+	doc, err := DecodeGeneric(r, from)
+	if err != nil {
+		return err
+	}
+	return EncodeGeneric(doc, w, to)
+}
+
+// typedDecoder is implemented by serializers which can only decode documents
+// into typed values, so have no generic representation.
+type typedDecoder interface {
+	typedOnly()
+}
+
+func decodeGeneric(s FormatSerializer, r io.Reader) (interface{}, error) {
+	if g, ok := s.(GenericSerializer); ok {
+		return g.DecodeGeneric(r)
+	}
+	if _, ok := s.(typedDecoder); ok {
+		return nil, &UnsupportedTypeError{
+			Type:   reflect.TypeOf((*interface{})(nil)).Elem(),
+			Reason: fmt.Sprintf("%T only decodes into typed values", s),
+		}
+	}
+
+	// Serializers without a generic codec decode to plain Go values, whose map keys get sorted.
+	var doc interface{}
+	if err := s.Decode(r, &doc); err != nil {
+		return nil, err
+	}
+	return toGeneric(reflect.ValueOf(doc))
+}
+
+func encodeGeneric(s FormatSerializer, v interface{}, w io.Writer) error {
+	if g, ok := s.(GenericSerializer); ok {
+		return g.EncodeGeneric(v, w)
+	}
+	doc, err := fromGeneric(v)
+	if err != nil {
+		return err
+	}
+	return s.Encode(doc, w)
+}
+
+// toGeneric normalizes a plain Go value into the generic representation.
+func toGeneric(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type() == timeType {
+		return v.Interface(), nil
+	}
+	if v.Type() == polymorphicType {
+		return v.Interface().(Polymorphic).generic()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toGeneric(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			raw := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(raw), v)
+			return raw, nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			var err error
+			if items[i], err = toGeneric(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case reflect.Map:
+		m := make(OrderedMap, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toGeneric(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			value, err := toGeneric(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, MapItem{Key: key, Value: value})
+		}
+		sort.Slice(m, func(i, j int) bool { return fmt.Sprint(m[i].Key) < fmt.Sprint(m[j].Key) })
+		return m, nil
+	case reflect.Struct:
+		fields := cachedFields(v.Type(), msgpackTags...)
+		m := make(OrderedMap, 0, len(fields))
+		for _, f := range fields {
+			if fv, ok := fieldByIndex(v, f.Index); ok {
+				value, err := toGeneric(fv)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, MapItem{Key: f.Name, Value: value})
+			}
+		}
+		return m, nil
+	}
+	return v.Interface(), nil
+}
+
+// fromGeneric converts the generic representation to plain Go values
+// understood by any serializer. Binary map keys become strings, other keys
+// which can't be map keys in Go (sequences and maps) are rejected.
+func fromGeneric(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(x))
+		for i, item := range x {
+			var err error
+			if items[i], err = fromGeneric(item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case OrderedMap:
+		keys := make([]interface{}, len(x))
+		stringKeys := true
+		for i, item := range x {
+			key, err := genericKey(item.Key)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(string); !ok {
+				stringKeys = false
+			}
+			keys[i] = key
+		}
+
+		if stringKeys {
+			m := make(map[string]interface{}, len(x))
+			for i, item := range x {
+				value, err := fromGeneric(item.Value)
+				if err != nil {
+					return nil, err
+				}
+				m[keys[i].(string)] = value
+			}
+			return m, nil
+		}
+
+		m := make(map[interface{}]interface{}, len(x))
+		for i, item := range x {
+			value, err := fromGeneric(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[keys[i]] = value
+		}
+		return m, nil
+	}
+	return v, nil
+}
+
+// genericKey returns a generic map key as a value usable as a Go map key.
+func genericKey(key interface{}) (interface{}, error) {
+	if b, ok := key.([]byte); ok {
+		return string(b), nil
+	}
+	if t := reflect.TypeOf(key); t != nil && !t.Comparable() {
+		return nil, &UnsupportedTypeError{Type: t, Reason: "map keys must be scalar values"}
+	}
+	return key, nil
+}
+
+// formatFloat formats a float so it reads back as a float rather than an integer.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+// DecodeGeneric decodes a JSON value, preserving key order and integers.
+func (m *JSONSerializer) DecodeGeneric(r io.Reader) (interface{}, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	doc, err := readJSONGeneric(decoder)
+	if err != nil {
+		return nil, decodeError(JSON, err, decoder.InputOffset())
+	}
+	return doc, nil
+}
+
+func readJSONGeneric(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := OrderedMap{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := readJSONGeneric(decoder)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, MapItem{Key: key, Value: value})
+			}
+			_, err := decoder.Token()
+			return m, err
+		case '[':
+			items := []interface{}{}
+			for decoder.More() {
+				value, err := readJSONGeneric(decoder)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, value)
+			}
+			_, err := decoder.Token()
+			return items, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter: %s", t)
+	case json.Number:
+		return parseNumber(string(t))
+	}
+	return token, nil
+}
+
+// parseNumber parses a textual number as an int64, an uint64 or a float64.
+func parseNumber(s string) (interface{}, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// EncodeGeneric encodes a generic value as JSON. Binary blobs are encoded as
+// base64 strings and timestamps as RFC 3339 strings.
+func (m *JSONSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := writeJSONGeneric(&buf, v); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeJSONGeneric(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+	case int64:
+		buf.WriteString(strconv.FormatInt(x, 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(x, 10))
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("json: unsupported float value %v", x)
+		}
+		buf.WriteString(formatFloat(x))
+	case string:
+		return writeJSONString(buf, x)
+	case []byte:
+		return writeJSONString(buf, base64.StdEncoding.EncodeToString(x))
+	case time.Time:
+		return writeJSONString(buf, x.Format(time.RFC3339Nano))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONGeneric(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case OrderedMap:
+		buf.WriteByte('{')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, ok := item.Key.(string)
+			if !ok {
+				key = fmt.Sprint(item.Key)
+			}
+			if err := writeJSONString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSONGeneric(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		doc, err := toGeneric(reflect.ValueOf(v))
+		if err != nil {
+			return err
+		}
+		return writeJSONGeneric(buf, doc)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	buf.Write(encoded)
+	return nil
+}
+
+// DecodeGeneric decodes a msgpack object, preserving key order, integers and binary blobs.
+func (m *MsgpackSerializer) DecodeGeneric(r io.Reader) (interface{}, error) {
+	var buf bytes.Buffer
+	if _, err := msgp.NewReader(r).CopyNext(&buf); err != nil {
+		return nil, decodeError(MsgPack, err, -1)
+	}
+
+	v, _, err := readMsgpackGeneric(buf.Bytes())
+	if err != nil {
+		return nil, decodeError(MsgPack, err, -1)
+	}
+	return v, nil
+}
+
+func readMsgpackGeneric(b []byte) (interface{}, []byte, error) {
+	switch msgp.NextType(b) {
+	case msgp.MapType:
+		sz, o, err := msgp.ReadMapHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		if err := checkMsgpackLength(sz, 2, o); err != nil {
+			return nil, o, err
+		}
+		m := make(OrderedMap, 0, sz)
+		for i := uint32(0); i < sz; i++ {
+			var item MapItem
+			if item.Key, o, err = readMsgpackGeneric(o); err != nil {
+				return nil, o, err
+			}
+			if item.Value, o, err = readMsgpackGeneric(o); err != nil {
+				return nil, o, err
+			}
+			m = append(m, item)
+		}
+		return m, o, nil
+	case msgp.ArrayType:
+		sz, o, err := msgp.ReadArrayHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		if err := checkMsgpackLength(sz, 1, o); err != nil {
+			return nil, o, err
+		}
+		items := make([]interface{}, sz)
+		for i := range items {
+			if items[i], o, err = readMsgpackGeneric(o); err != nil {
+				return nil, o, err
+			}
+		}
+		return items, o, nil
+	case msgp.Float32Type:
+		f, o, err := msgp.ReadFloat32Bytes(b)
+		return float64(f), o, err
+	case msgp.ExtensionType:
+		if t, o, err := readMsgpackTimestamp(b); err == nil {
+			return t, o, nil
+		}
+	}
+	return msgp.ReadIntfBytes(b)
+}
+
+// EncodeGeneric encodes a generic value as msgpack.
+func (m *MsgpackSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	data, err := appendMsgpackGeneric(nil, v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func appendMsgpackGeneric(b []byte, v interface{}) ([]byte, error) {
+	var err error
+
+	switch x := v.(type) {
+	case []interface{}:
+		b = msgp.AppendArrayHeader(b, uint32(len(x)))
+		for _, item := range x {
+			if b, err = appendMsgpackGeneric(b, item); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case OrderedMap:
+		b = msgp.AppendMapHeader(b, uint32(len(x)))
+		for _, item := range x {
+			if b, err = appendMsgpackGeneric(b, item.Key); err != nil {
+				return b, err
+			}
+			if b, err = appendMsgpackGeneric(b, item.Value); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	return msgpackEncoder{}.append(b, reflect.ValueOf(v))
+}
+
+// DecodeGeneric decodes a YAML document, preserving key order, integers and !!binary blobs.
+func (m *YAMLSerializer) DecodeGeneric(r io.Reader) (interface{}, error) {
+	var node yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&node); err != nil {
+		return nil, decodeError(YAML, err, -1)
+	}
+
+	doc, err := yamlNodeToGeneric(&node)
+	if err != nil {
+		return nil, decodeError(YAML, err, -1)
+	}
+	return doc, nil
+}
+
+// yamlNodeToGeneric converts a yaml node into the generic representation,
+// expanding aliases. Recursive aliases are rejected, and expansion is bounded
+// the way yaml.v3 bounds it so small documents can't expand exponentially.
+func yamlNodeToGeneric(node *yaml.Node) (interface{}, error) {
+	c := &yamlConverter{expanding: make(map[*yaml.Node]bool)}
+	return c.convert(node)
+}
+
+type yamlConverter struct {
+	expanding map[*yaml.Node]bool
+
+	// nodes counts every converted node, aliased counts those converted through an alias.
+	nodes, aliased int
+}
+
+// allowedAliasRatio returns the share of nodes which may come from aliases,
+// after nodes were converted. It is the ratio yaml.v3 applies when decoding.
+func allowedAliasRatio(nodes int) float64 {
+	switch {
+	case nodes <= 400000:
+		return 0.99
+	case nodes >= 4000000:
+		return 0.10
+	default:
+		return 0.99 - 0.89*float64(nodes-400000)/3600000
+	}
+}
+
+func (c *yamlConverter) convert(node *yaml.Node) (interface{}, error) {
+	c.nodes++
+	if len(c.expanding) > 0 {
+		c.aliased++
+		if c.aliased > 100 && c.nodes > 1000 && float64(c.aliased)/float64(c.nodes) > allowedAliasRatio(c.nodes) {
+			return nil, errors.New("document contains excessive aliasing")
+		}
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return c.convert(node.Content[0])
+	case yaml.AliasNode:
+		if c.expanding[node.Alias] {
+			return nil, fmt.Errorf("anchor %q is an alias of itself", node.Value)
+		}
+		c.expanding[node.Alias] = true
+		v, err := c.convert(node.Alias)
+		delete(c.expanding, node.Alias)
+		return v, err
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			var err error
+			if items[i], err = c.convert(child); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case yaml.MappingNode:
+		m := make(OrderedMap, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, err := c.convert(node.Content[i])
+			if err != nil {
+				return nil, err
+			}
+			value, err := c.convert(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, MapItem{Key: key, Value: value})
+		}
+		return m, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := node.Decode(&b)
+		return b, err
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err == nil {
+			return i, nil
+		}
+		var u uint64
+		err := node.Decode(&u)
+		return u, err
+	case "!!float":
+		var f float64
+		err := node.Decode(&f)
+		return f, err
+	case "!!binary":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(node.Value), ""))
+	case "!!timestamp":
+		var t time.Time
+		err := node.Decode(&t)
+		return t, err
+	}
+	return node.Value, nil
+}
+
+// EncodeGeneric encodes a generic value as a YAML document.
+func (m *YAMLSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	node, err := genericToYAMLNode(v)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func genericToYAMLNode(v interface{}) (*yaml.Node, error) {
+	scalar := func(tag, value string) (*yaml.Node, error) {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}, nil
+	}
+
+	switch x := v.(type) {
+	case nil:
+		return scalar("!!null", "null")
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(x))
+	case int64:
+		return scalar("!!int", strconv.FormatInt(x, 10))
+	case uint64:
+		return scalar("!!int", strconv.FormatUint(x, 10))
+	case float64:
+		switch {
+		case math.IsNaN(x):
+			return scalar("!!float", ".nan")
+		case math.IsInf(x, 1):
+			return scalar("!!float", ".inf")
+		case math.IsInf(x, -1):
+			return scalar("!!float", "-.inf")
+		}
+		return scalar("!!float", formatFloat(x))
+	case string:
+		return scalar("!!str", x)
+	case []byte:
+		return scalar("!!binary", base64.StdEncoding.EncodeToString(x))
+	case time.Time:
+		return scalar("!!timestamp", x.Format(time.RFC3339Nano))
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range x {
+			child, err := genericToYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case OrderedMap:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, item := range x {
+			key, err := genericToYAMLNode(item.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := genericToYAMLNode(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, key, value)
+		}
+		return node, nil
+	}
+	doc, err := toGeneric(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return genericToYAMLNode(doc)
+}
+
+// DecodeGeneric decompresses the stream and decodes it with the inner serializer.
+func (m *CompressedSerializer) DecodeGeneric(r io.Reader) (interface{}, error) {
+	data, err := readDocument(r, m.DecodeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if c, ok := detectCompression(data); ok {
+		reader, err := c.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return decodeGeneric(m.Serializer, reader)
+	}
+	return decodeGeneric(m.Serializer, bytes.NewReader(data))
+}
+
+// EncodeGeneric encodes the value with the inner serializer and compresses it.
+func (m *CompressedSerializer) EncodeGeneric(v interface{}, w io.Writer) error {
+	writer, err := m.Compression.NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if err := encodeGeneric(m.Serializer, v, writer); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
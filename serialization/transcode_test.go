@@ -0,0 +1,141 @@
+package serialization_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+func Test_TranscodeJSONToYAML(t *testing.T) {
+	in := `{"zeta": 1, "alpha": 1.0, "nested": {"b": [1, 2.5, "three"], "a": null}, "flag": true}`
+
+	var out bytes.Buffer
+	if err := serialization.Transcode(strings.NewReader(in), serialization.JSON, &out, serialization.YAML); err != nil {
+		t.Errorf("Transcode() error = %s", err.Error())
+		return
+	}
+
+	want := "zeta: 1\nalpha: 1.0\nnested:\n    b:\n        - 1\n        - 2.5\n        - three\n    a: null\nflag: true\n"
+	if out.String() != want {
+		t.Errorf("Transcode() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func Test_TranscodeRoundTrip(t *testing.T) {
+	in := `{"z":1,"a":1.0,"s":"123","list":[-1,18446744073709551615,true,null],"m":{"y":"x"}}`
+	formats := []serialization.Format{
+		serialization.MsgPack,
+		serialization.YAML,
+		serialization.Compressed(serialization.MsgPack, serialization.Gzip),
+	}
+
+	for _, format := range formats {
+		t.Run(string(format), func(t *testing.T) {
+			var intermediate bytes.Buffer
+			if err := serialization.Transcode(strings.NewReader(in), serialization.JSON, &intermediate, format); err != nil {
+				t.Errorf("Transcode() to %s error = %s", format, err.Error())
+				return
+			}
+
+			var out bytes.Buffer
+			if err := serialization.Transcode(&intermediate, format, &out, serialization.JSON); err != nil {
+				t.Errorf("Transcode() from %s error = %s", format, err.Error())
+				return
+			}
+
+			if strings.TrimSpace(out.String()) != in {
+				t.Errorf("round trip through %s =\n%s\nwant\n%s", format, out.String(), in)
+			}
+		})
+	}
+}
+
+func Test_TranscodeBinary(t *testing.T) {
+	blob := []byte{0x00, 0xff, 0x10}
+
+	data, err := serialization.Marshal(map[string][]byte{"blob": blob}, serialization.MsgPack)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var yamlDoc bytes.Buffer
+	if err := serialization.Transcode(bytes.NewReader(data), serialization.MsgPack, &yamlDoc, serialization.YAML); err != nil {
+		t.Errorf("Transcode() error = %s", err.Error())
+		return
+	}
+	if !strings.Contains(yamlDoc.String(), "!!binary") {
+		t.Errorf("binary blob not tagged in yaml:\n%s", yamlDoc.String())
+	}
+
+	var back bytes.Buffer
+	if err := serialization.Transcode(&yamlDoc, serialization.YAML, &back, serialization.MsgPack); err != nil {
+		t.Errorf("Transcode() error = %s", err.Error())
+		return
+	}
+	if !bytes.Equal(back.Bytes(), data) {
+		t.Errorf("binary round trip = %x, want %x", back.Bytes(), data)
+	}
+}
+
+func Test_TranscodeYAMLAliases(t *testing.T) {
+	var out bytes.Buffer
+	if err := serialization.Transcode(strings.NewReader("base: &b {a: 1}\ncopy: *b\n"), serialization.YAML, &out, serialization.JSON); err != nil {
+		t.Errorf("Transcode() error = %s", err.Error())
+		return
+	}
+	if strings.TrimSpace(out.String()) != `{"base":{"a":1},"copy":{"a":1}}` {
+		t.Errorf("Transcode() = %s", out.String())
+	}
+
+	laughs := "a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for c := 'b'; c <= 'i'; c++ {
+		laughs += fmt.Sprintf("%c: &%c [*%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c, *%c]\n", c, c, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1, c-1)
+	}
+
+	tests := map[string]string{
+		"recursive":      "a: &x [*x]\n",
+		"billion laughs": laughs,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := serialization.DecodeGeneric(strings.NewReader(doc), serialization.YAML); err == nil {
+				t.Errorf("DecodeGeneric() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func Test_TranscodeMsgpackHostileLengths(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xdf, 0xff, 0xff, 0xff, 0xff, 0x01, 0x01},
+	} {
+		if _, err := serialization.DecodeGeneric(bytes.NewReader(data), serialization.MsgPack); err == nil {
+			t.Errorf("DecodeGeneric(%x) error = nil, want an error", data)
+		}
+	}
+}
+
+func Test_TranscodeMapKeys(t *testing.T) {
+	// A msgpack map with a bin key, {bin("k"): 1}.
+	var out bytes.Buffer
+	if err := serialization.Transcode(bytes.NewReader([]byte{0x81, 0xc4, 0x01, 'k', 0x01}), serialization.MsgPack, &out, serialization.TOML); err != nil {
+		t.Errorf("Transcode() error = %s", err.Error())
+		return
+	}
+	if strings.TrimSpace(out.String()) != "k = 1" {
+		t.Errorf("Transcode() = %q, want %q", out.String(), "k = 1")
+	}
+
+	out.Reset()
+	err := serialization.Transcode(strings.NewReader("? [a, b]\n: 1\n"), serialization.YAML, &out, serialization.CBOR)
+	var typeErr *serialization.UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Transcode() error = %v, want UnsupportedTypeError", err)
+	}
+}
@@ -0,0 +1,186 @@
+package serialization
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Versioned is the envelope wrapping a payload with its schema version.
+type Versioned struct {
+	Version int         `json:"version" msg:"version" yaml:"version"`
+	Payload interface{} `json:"payload" msg:"payload" yaml:"payload"`
+}
+
+// Migration upgrades a generic document (as decoded into an interface{})
+// from one schema version to the next.
+type Migration func(doc interface{}) (interface{}, error)
+
+// MigrationRegistry holds the migrations of a document type, keyed by the version they upgrade from.
+type MigrationRegistry struct {
+	migrations map[int]Migration
+	lock       sync.RWMutex
+}
+
+// NewMigrationRegistry returns an empty migration registry.
+func NewMigrationRegistry() *MigrationRegistry {
+	return &MigrationRegistry{migrations: make(map[int]Migration)}
+}
+
+// Register adds the migration upgrading documents from version `from` to `from+1`.
+func (r *MigrationRegistry) Register(from int, migration Migration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.migrations[from] = migration
+}
+
+// Migrate runs the chain of migrations upgrading doc from version `from` to version `to`.
+func (r *MigrationRegistry) Migrate(doc interface{}, from, to int) (interface{}, error) {
+	if from > to {
+		return nil, fmt.Errorf("document version %d is newer than supported version %d", from, to)
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for version := from; version < to; version++ {
+		migration, ok := r.migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d to %d", version, version+1)
+		}
+
+		var err error
+		if doc, err = migration(doc); err != nil {
+			return nil, fmt.Errorf("migration from version %d to %d: %w", version, version+1, err)
+		}
+	}
+	return doc, nil
+}
+
+// VersionedSerializer wraps payloads serialized in Format in a Versioned envelope.
+// Decoding an older document runs the registered migrations up to Version
+// before filling the target struct. Documents without an envelope are
+// considered to be at version 0.
+type VersionedSerializer struct {
+	Format     Format
+	Version    int
+	Migrations *MigrationRegistry
+}
+
+// Marshal wraps inStruct in a versioned envelope and serializes it.
+func (m *VersionedSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return Marshal(&Versioned{Version: m.Version, Payload: inStruct}, m.Format)
+}
+
+// Unmarshal unwraps and migrates a raw message, then loads it into the struct.
+func (m *VersionedSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	var doc interface{}
+	if err := Unmarshal(rawBytes, &doc, m.Format); err != nil {
+		return err
+	}
+
+	version, payload, err := unwrapVersioned(doc)
+	if err != nil {
+		return err
+	}
+
+	if version != m.Version {
+		migrations := m.Migrations
+		if migrations == nil {
+			migrations = NewMigrationRegistry()
+		}
+		if payload, err = migrations.Migrate(payload, version, m.Version); err != nil {
+			return err
+		}
+	}
+
+	// The migrated document is round-tripped through the format to fill the struct.
+	data, err := Marshal(payload, m.Format)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, outStruct, m.Format)
+}
+
+// Encode wraps the struct in a versioned envelope and writes it to a stream.
+func (m *VersionedSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return Encode(&Versioned{Version: m.Version, Payload: inStruct}, w, m.Format)
+}
+
+// Decode reads a whole document from the stream, migrates it and loads it into the struct.
+func (m *VersionedSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(data, outStruct)
+}
+
+// unwrapVersioned extracts the version and payload of a generic document.
+// Maps decoded with interface{} keys (as CBOR does) are converted to string
+// keyed maps, so migrations see the same documents in every format.
+func unwrapVersioned(doc interface{}) (int, interface{}, error) {
+	doc = stringKeyed(doc)
+	envelope, ok := doc.(map[string]interface{})
+	if !ok || len(envelope) != 2 {
+		return 0, doc, nil
+	}
+
+	rawVersion, hasVersion := envelope["version"]
+	payload, hasPayload := envelope["payload"]
+	if !hasVersion || !hasPayload {
+		return 0, doc, nil
+	}
+
+	version, ok := genericInt(rawVersion)
+	if !ok {
+		return 0, nil, errors.New("invalid envelope version")
+	}
+	return version, payload, nil
+}
+
+// genericInt converts a number decoded into an interface{} by any format to an int.
+func genericInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// stringKeyed converts the maps of a document decoded into an interface{}
+// whose keys are all strings to map[string]interface{}.
+func stringKeyed(doc interface{}) interface{} {
+	switch x := doc.(type) {
+	case []interface{}:
+		for i, item := range x {
+			x[i] = stringKeyed(item)
+		}
+	case map[string]interface{}:
+		for k, v := range x {
+			x[k] = stringKeyed(v)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			key, ok := k.(string)
+			if !ok {
+				return x
+			}
+			m[key] = stringKeyed(v)
+		}
+		return m
+	}
+	return doc
+}
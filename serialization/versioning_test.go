@@ -0,0 +1,107 @@
+package serialization_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+// settingsV2 renamed "host" to "address" and added "port".
+type settingsV2 struct {
+	Address string `json:"address" msg:"address" yaml:"address"`
+	Port    int    `json:"port" msg:"port" yaml:"port"`
+}
+
+func settingsMigrations() *serialization.MigrationRegistry {
+	migrations := serialization.NewMigrationRegistry()
+	migrations.Register(0, func(doc interface{}) (interface{}, error) {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expected a map")
+		}
+		m["address"] = m["host"]
+		delete(m, "host")
+		return m, nil
+	})
+	migrations.Register(1, func(doc interface{}) (interface{}, error) {
+		m := doc.(map[string]interface{})
+		m["port"] = 80
+		return m, nil
+	})
+	return migrations
+}
+
+func Test_VersionedMigration(t *testing.T) {
+	for _, format := range []serialization.Format{serialization.JSON, serialization.MsgPack, serialization.YAML, serialization.CBOR} {
+		t.Run(string(format), func(t *testing.T) {
+			v1 := &serialization.VersionedSerializer{Format: format, Version: 1}
+			v2 := &serialization.VersionedSerializer{Format: format, Version: 2, Migrations: settingsMigrations()}
+
+			// Version 1 only had the "address" field.
+			old, err := v1.Marshal(map[string]interface{}{"address": "example.com"})
+			if err != nil {
+				t.Errorf("Marshal() error = %s", err.Error())
+				return
+			}
+
+			var out settingsV2
+			if err := v2.Decode(bytes.NewReader(old), &out); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if out.Address != "example.com" || out.Port != 80 {
+				t.Errorf("Decode() = %+v", out)
+			}
+
+			// Current documents are decoded as is.
+			var current bytes.Buffer
+			if err := v2.Encode(&settingsV2{Address: "a", Port: 1}, &current); err != nil {
+				t.Errorf("Encode() error = %s", err.Error())
+				return
+			}
+			out = settingsV2{}
+			if err := v2.Decode(&current, &out); err != nil {
+				t.Errorf("Decode() error = %s", err.Error())
+				return
+			}
+			if out.Address != "a" || out.Port != 1 {
+				t.Errorf("Decode() = %+v", out)
+			}
+		})
+	}
+}
+
+func Test_VersionedLegacyDocument(t *testing.T) {
+	v2 := &serialization.VersionedSerializer{Format: serialization.JSON, Version: 2, Migrations: settingsMigrations()}
+
+	var out settingsV2
+	if err := v2.Unmarshal([]byte(`{"host": "legacy"}`), &out); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+	if out.Address != "legacy" || out.Port != 80 {
+		t.Errorf("Unmarshal() = %+v", out)
+	}
+}
+
+func Test_VersionedErrors(t *testing.T) {
+	v1 := &serialization.VersionedSerializer{Format: serialization.JSON, Version: 1}
+
+	var out settingsV2
+	if err := v1.Unmarshal([]byte(`{"version": 3, "payload": {}}`), &out); err == nil {
+		t.Error("expected an error for a newer document")
+	}
+	if err := v1.Unmarshal([]byte(`{"version": 0, "payload": {}}`), &out); err == nil {
+		t.Error("expected an error for a missing migration")
+	}
+
+	errFailed := errors.New("failed")
+	migrations := serialization.NewMigrationRegistry()
+	migrations.Register(0, func(doc interface{}) (interface{}, error) { return nil, errFailed })
+	v1.Migrations = migrations
+	if err := v1.Unmarshal([]byte(`{"version": 0, "payload": {}}`), &out); !errors.Is(err, errFailed) {
+		t.Errorf("Unmarshal() error = %v, want the migration error", err)
+	}
+}
@@ -0,0 +1,78 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// XMLSerializer serializes messages to xml, following the rules of encoding/xml:
+// maps are not supported and the root element is named after the type or its XMLName field.
+//
+// Decoding checks are limited to the size, structural limits and trailing
+// data: xml documents have no generic representation to check fields against.
+type XMLSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
+}
+
+// Marshal marshals inStruct to xml.
+func (m *XMLSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to xml using the given options.
+func (m *XMLSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if opts.Indent != "" {
+		data, err = xml.MarshalIndent(inStruct, "", opts.Indent)
+	} else {
+		data, err = xml.Marshal(inStruct)
+	}
+	return data, encodeError(err)
+}
+
+// Unmarshal unmarshals a raw xml message to a struct.
+func (m *XMLSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(XML, err, -1)
+	}
+	return m.decode(bytes.NewReader(rawBytes), outStruct)
+}
+
+// Encode marshals the struct to a stream.
+func (m *XMLSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+func (m *XMLSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", opts.Indent)
+	if err := encoder.Encode(inStruct); err != nil {
+		return encodeError(err)
+	}
+	return encoder.Flush()
+}
+
+// Decode unmarshals the struct from a stream.
+func (m *XMLSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+	return m.decode(r, outStruct)
+}
+
+func (m *XMLSerializer) decode(r io.Reader, outStruct interface{}) error {
+	decoder := xml.NewDecoder(r)
+	if err := decoder.Decode(outStruct); err != nil {
+		return decodeError(XML, err, decoder.InputOffset())
+	}
+	return nil
+}
+
+// typedOnly marks XML as having no generic representation.
+func (m *XMLSerializer) typedOnly() {}
@@ -0,0 +1,130 @@
+package serialization
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLSerializer serializes messages to yaml.
+type YAMLSerializer struct {
+	EncodeOptions EncodeOptions
+	DecodeOptions DecodeOptions
+}
+
+// Marshal marshals inStruct to yaml.
+func (m *YAMLSerializer) Marshal(inStruct interface{}) ([]byte, error) {
+	return m.MarshalWithOptions(inStruct, m.EncodeOptions)
+}
+
+// MarshalWithOptions marshals inStruct to yaml using the given options.
+func (m *YAMLSerializer) MarshalWithOptions(inStruct interface{}, opts EncodeOptions) ([]byte, error) {
+	if opts == (EncodeOptions{}) {
+		var data []byte
+		err := encodeYAML(func() (err error) {
+			data, err = yaml.Marshal(inStruct)
+			return err
+		})
+		return data, err
+	}
+
+	return marshalPooled(func(w io.Writer) error {
+		return m.EncodeWithOptions(inStruct, w, opts)
+	})
+}
+
+// Unmarshal unmarshals a raw yaml message to a struct.
+func (m *YAMLSerializer) Unmarshal(rawBytes []byte, outStruct interface{}) error {
+	if err := checkDocument(m, rawBytes, outStruct, m.DecodeOptions); err != nil {
+		return decodeError(YAML, err, -1)
+	}
+	return m.decode(bytes.NewReader(rawBytes), outStruct)
+}
+
+// Encode marshals the struct to a stream.
+func (m *YAMLSerializer) Encode(inStruct interface{}, w io.Writer) error {
+	return m.EncodeWithOptions(inStruct, w, m.EncodeOptions)
+}
+
+// EncodeWithOptions marshals the struct to a stream using the given options.
+func (m *YAMLSerializer) EncodeWithOptions(inStruct interface{}, w io.Writer, opts EncodeOptions) error {
+	encoder := yaml.NewEncoder(w)
+	if opts.Indent != "" {
+		encoder.SetIndent(len(opts.Indent))
+	}
+	if err := encodeYAML(func() error { return encoder.Encode(inStruct) }); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// encodeYAML runs encode, turning the panics of yaml.v3 on types it cannot
+// represent into an UnsupportedTypeError.
+func encodeYAML(encode func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg, ok := r.(string)
+			if !ok || !strings.HasPrefix(msg, "cannot marshal type") {
+				panic(r)
+			}
+			err = &UnsupportedTypeError{Reason: msg}
+		}
+	}()
+	return encode()
+}
+
+// Decode unmarshals the struct from a stream.
+//
+// When the stream contains several documents, outStruct must be a pointer
+// to a slice and each document is decoded into its own element.
+func (m *YAMLSerializer) Decode(r io.Reader, outStruct interface{}) error {
+	if checked, err := decodeWithOptions(m, r, outStruct, m.DecodeOptions); checked {
+		return err
+	}
+	return m.decode(r, outStruct)
+}
+
+func (m *YAMLSerializer) decode(r io.Reader, outStruct interface{}) error {
+	decoder := yaml.NewDecoder(r)
+
+	var documents []*yaml.Node
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return decodeError(YAML, err, -1)
+		}
+		documents = append(documents, &node)
+	}
+
+	switch len(documents) {
+	case 0:
+		return io.EOF
+	case 1:
+		return decodeError(YAML, documents[0].Decode(outStruct), -1)
+	}
+
+	outValue := reflect.ValueOf(outStruct)
+	if outValue.Kind() != reflect.Ptr || outValue.Elem().Kind() != reflect.Slice {
+		return &UnsupportedTypeError{
+			Type:   reflect.TypeOf(outStruct),
+			Reason: fmt.Sprintf("yaml stream contains %d documents, outStruct must be a pointer to a slice", len(documents)),
+		}
+	}
+
+	slice := outValue.Elem()
+	items := reflect.MakeSlice(slice.Type(), len(documents), len(documents))
+	for i, document := range documents {
+		if err := document.Decode(items.Index(i).Addr().Interface()); err != nil {
+			return withPath(YAML, decodeError(YAML, err, -1), fmt.Sprintf("[%d]", i))
+		}
+	}
+	slice.Set(items)
+	return nil
+}
@@ -0,0 +1,74 @@
+package serialization_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/purposed/good/serialization"
+)
+
+type yamlConfig struct {
+	Name  string   `yaml:"name"`
+	Port  int      `yaml:"port"`
+	Hosts []string `yaml:"hosts"`
+}
+
+func Test_YAMLRoundTrip(t *testing.T) {
+	in := yamlConfig{Name: "svc", Port: 8080, Hosts: []string{"a", "b"}}
+
+	data, err := serialization.Marshal(&in, serialization.YAML)
+	if err != nil {
+		t.Errorf("Marshal() error = %s", err.Error())
+		return
+	}
+
+	var out yamlConfig
+	if err := serialization.Unmarshal(data, &out, serialization.YAML); err != nil {
+		t.Errorf("Unmarshal() error = %s", err.Error())
+		return
+	}
+
+	if out.Name != in.Name || out.Port != in.Port || len(out.Hosts) != 2 {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+func Test_YAMLEncodeDecode(t *testing.T) {
+	in := yamlConfig{Name: "svc", Port: 1}
+
+	var buf bytes.Buffer
+	if err := serialization.Encode(&in, &buf, serialization.YAML); err != nil {
+		t.Errorf("Encode() error = %s", err.Error())
+		return
+	}
+
+	var out yamlConfig
+	if err := serialization.Decode(&buf, &out, serialization.YAML); err != nil {
+		t.Errorf("Decode() error = %s", err.Error())
+		return
+	}
+
+	if out.Name != in.Name || out.Port != in.Port {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+func Test_YAMLDecodeMultiDocument(t *testing.T) {
+	stream := "name: a\nport: 1\n---\nname: b\nport: 2\n"
+
+	var out []yamlConfig
+	if err := serialization.Decode(strings.NewReader(stream), &out, serialization.YAML); err != nil {
+		t.Errorf("Decode() error = %s", err.Error())
+		return
+	}
+
+	if len(out) != 2 || out[0].Name != "a" || out[1].Port != 2 {
+		t.Errorf("unexpected documents: %+v", out)
+	}
+
+	var single yamlConfig
+	if err := serialization.Decode(strings.NewReader(stream), &single, serialization.YAML); err == nil {
+		t.Error("expected an error when decoding several documents into a struct")
+	}
+}